@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignerVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	signer := NewSigner([]byte("secret"))
+	signer.now = func() time.Time { return now }
+
+	token, err := signer.Sign("alice", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+
+	payload, signature, _ := strings.Cut(token, ".")
+	otherSigner := NewSigner([]byte("other secret"))
+	otherSigner.now = signer.now
+	otherToken, _ := otherSigner.Sign("alice", time.Hour)
+	_, otherSignature, _ := strings.Cut(otherToken, ".")
+
+	cases := []struct {
+		description string
+		token       string
+		at          time.Time
+		err         error
+	}{
+		{description: "Valid token", token: token, at: now},
+		{description: "Just before expiry", token: token, at: now.Add(time.Hour - time.Second)},
+		{description: "Expired token", token: token, at: now.Add(time.Hour), err: ErrExpiredToken},
+		{description: "Other secret", token: otherToken, at: now, err: ErrBadSignature},
+		{description: "Swapped signature", token: payload + "." + otherSignature, at: now, err: ErrBadSignature},
+		{description: "Tampered payload", token: "x" + payload + "." + signature, at: now, err: ErrBadSignature},
+		{description: "Missing signature", token: payload, at: now, err: ErrMalformedToken},
+		{description: "Invalid base64", token: payload + ".!!", at: now, err: ErrMalformedToken},
+		{description: "Empty token", token: "", at: now, err: ErrMalformedToken},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			signer.now = func() time.Time { return c.at }
+
+			identity, err := signer.Verify(c.token)
+			if c.err != nil {
+				if !errors.Is(err, c.err) {
+					t.Errorf("Expected error: %v, got: %v", c.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if identity.UserId != "alice" || !identity.ExpiresAt.Equal(now.Add(time.Hour)) {
+				t.Errorf("Unexpected identity: %+v", identity)
+			}
+		})
+	}
+}
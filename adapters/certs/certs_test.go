@@ -0,0 +1,140 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSelfSignedConfig(t *testing.T) {
+	config, err := SelfSignedConfig()
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("hi"))
+	}()
+
+	leaf := config.Certificates[0].Leaf
+	if leaf.IsCA || leaf.KeyUsage&x509.KeyUsageCertSign != 0 {
+		t.Errorf("Expected a leaf unable to sign certificates")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+
+	for _, serverName := range []string{"localhost", "127.0.0.1"} {
+		t.Run(serverName, func(t *testing.T) {
+			err := config.Certificates[0].Leaf.VerifyHostname(serverName)
+			if err != nil {
+				t.Errorf("Expected certificate to be valid for %s: %v", serverName, err)
+			}
+		})
+	}
+
+	conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{RootCAs: roots, ServerName: "localhost"})
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	received := make([]byte, 2)
+	_, err = conn.Read(received)
+	if err != nil || string(received) != "hi" {
+		t.Errorf("Expected [hi] found [%s] %v", received, err)
+	}
+}
+
+func writeKeyPair(t *testing.T, certFile string, keyFile string, modTime time.Time) tls.Certificate {
+	certificate, err := SelfSigned([]string{"localhost"})
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+
+	key, err := x509.MarshalPKCS8PrivateKey(certificate.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Certificate[0]})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})
+	for file, content := range map[string][]byte{certFile: certPem, keyFile: keyPem} {
+		err = os.WriteFile(file, content, 0600)
+		if err != nil {
+			t.Fatalf("Failed to write %s: %v", file, err)
+		}
+
+		err = os.Chtimes(file, modTime, modTime)
+		if err != nil {
+			t.Fatalf("Failed to touch %s: %v", file, err)
+		}
+	}
+
+	return certificate
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Hour)
+
+	first := writeKeyPair(t, certFile, keyFile, start)
+	reloader, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	serial := func() string {
+		reloader.checkedAt = time.Time{}
+		certificate, err := reloader.GetCertificate(nil)
+		if err != nil {
+			t.Fatalf("Failed to get certificate: %v", err)
+		}
+
+		leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+		if err != nil {
+			t.Fatalf("Failed to parse certificate: %v", err)
+		}
+		return leaf.SerialNumber.String()
+	}
+
+	if serial() != first.Leaf.SerialNumber.String() {
+		t.Errorf("Expected the first certificate")
+	}
+
+	second := writeKeyPair(t, certFile, keyFile, start.Add(time.Minute))
+	if serial() != second.Leaf.SerialNumber.String() {
+		t.Errorf("Expected the renewed certificate to be reloaded")
+	}
+
+	// A broken renewal keeps serving the last good certificate.
+	os.WriteFile(keyFile, []byte("garbage"), 0600)
+	os.Chtimes(keyFile, start.Add(2*time.Minute), start.Add(2*time.Minute))
+	if serial() != second.Leaf.SerialNumber.String() {
+		t.Errorf("Expected the last good certificate after a broken renewal")
+	}
+}
+
+func TestReloaderMissingFiles(t *testing.T) {
+	_, err := NewReloader("missing.pem", "missing.key")
+	if err == nil {
+		t.Errorf("Expected missing files to fail")
+	}
+}
@@ -0,0 +1,106 @@
+package certs
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// How often the certificate files are checked for changes.
+const reloadCheckInterval = time.Second
+
+// Reloader serves a certificate loaded from files and reloads it when the
+// files change, so renewed certificates are picked up without a restart.
+// Files are checked at most once per interval, when a client connects.
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mutex       sync.Mutex
+	certificate *tls.Certificate
+	modTime     time.Time
+	checkedAt   time.Time
+}
+
+func NewReloader(certFile string, keyFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	modTime, err := r.lastModified()
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.load(modTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetCertificate is meant for tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if time.Since(r.checkedAt) < reloadCheckInterval {
+		return r.certificate, nil
+	}
+	r.checkedAt = time.Now()
+
+	modTime, err := r.lastModified()
+	if err == nil && !modTime.Equal(r.modTime) {
+		err = r.load(modTime)
+	}
+
+	// A half written renewal keeps the previous certificate.
+	if err != nil {
+		log.Printf("Failed to reload certificate %s: %v", r.certFile, err)
+	}
+
+	return r.certificate, nil
+}
+
+// Config makes a server configuration serving the reloaded certificate.
+func (r *Reloader) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+func (r *Reloader) load(modTime time.Time) error {
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	r.certificate = &certificate
+	r.modTime = modTime
+	return nil
+}
+
+// lastModified is the latest change to either file.
+func (r *Reloader) lastModified() (time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if keyInfo.ModTime().After(certInfo.ModTime()) {
+		return keyInfo.ModTime(), nil
+	}
+
+	return certInfo.ModTime(), nil
+}
@@ -0,0 +1,444 @@
+package chat
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shakram02/nony-chat/adapters/http/router"
+	"github.com/shakram02/nony-chat/adapters/nony"
+	"github.com/shakram02/nony-chat/adapters/protocol/transport"
+	"github.com/shakram02/nony-chat/adapters/websockets"
+)
+
+// harness boots the connection handlers over in-memory connections and
+// drives scripted client sessions against them, byte for byte. The test
+// plays the application too, each socket routed to /chats/{roomId} is
+// bridged to an app it scripts through an in-memory transport. Sockets
+// routed to /rooms/{roomId} are served in the rooms, with line clients.
+type harness struct {
+	t      *testing.T
+	ctx    context.Context
+	cancel context.CancelFunc
+	server *Server
+	lines  *LineServer
+	rooms  *Rooms
+	apps   chan *app
+}
+
+func newHarness(t *testing.T) *harness {
+	rooms := NewRooms()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	h := &harness{
+		t:      t,
+		ctx:    ctx,
+		cancel: cancel,
+		server: NewServer(64, 1024),
+		lines:  NewLineServer(rooms, 64, 1024),
+		rooms:  rooms,
+		apps:   make(chan *app, 8),
+	}
+
+	h.server.Handle("/chats/{roomId}", h.bridge)
+	h.server.Handle("/rooms/{roomId}", rooms.HandleSocket)
+	return h
+}
+
+// app is the application's end of a socket.
+type app struct {
+	t       *testing.T
+	request router.Request
+	packets *transport.Pipe[*nony.Packet]
+	// The error that ended reading the socket.
+	err chan error
+}
+
+// bridge relays the packets between the socket and a new app.
+func (h *harness) bridge(ctx context.Context, socket *transport.NonySocket, request router.Request) {
+	appEnd, socketEnd := transport.NewPipe[*nony.Packet](8)
+	a := &app{t: h.t, request: request, packets: appEnd, err: make(chan error, 1)}
+	h.apps <- a
+
+	go func() {
+		for {
+			packet, err := socketEnd.Read(ctx)
+			if err != nil {
+				return
+			}
+			socket.Write(ctx, packet)
+		}
+	}()
+
+	for {
+		packet, err := socket.Read(ctx)
+		if err != nil {
+			a.err <- err
+			socketEnd.Close()
+			socket.Close()
+			return
+		}
+		socketEnd.Write(ctx, packet)
+	}
+}
+
+// accept waits for the next socket routed to an app.
+func (h *harness) accept() *app {
+	h.t.Helper()
+
+	select {
+	case a := <-h.apps:
+		return a
+	case <-time.After(sessionTimeout):
+		h.t.Fatalf("Expected a socket to be routed")
+		return nil
+	}
+}
+
+// connect opens a client connection served by the handler.
+func (h *harness) connect() *session {
+	return h.open(h.server.HandleConnection)
+}
+
+// connectLines opens a client connection served by the line server.
+func (h *harness) connectLines() *session {
+	return h.open(h.lines.HandleConnection)
+}
+
+func (h *harness) open(handle func(ctx context.Context, conn net.Conn)) *session {
+	serverConn, clientConn := net.Pipe()
+
+	served := make(chan struct{})
+	go func() {
+		handle(h.ctx, serverConn)
+		close(served)
+	}()
+
+	h.t.Cleanup(func() {
+		clientConn.Close()
+		<-served
+	})
+
+	return &session{
+		t:      h.t,
+		conn:   clientConn,
+		reader: bufio.NewReader(clientConn),
+	}
+}
+
+func (a *app) expectPacket(expected *nony.Packet) {
+	a.t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), sessionTimeout)
+	defer cancel()
+
+	packet, err := a.packets.Read(ctx)
+	if err != nil {
+		a.t.Fatalf("Failed to read packet: %v", err)
+	}
+
+	if !reflect.DeepEqual(packet, expected) {
+		a.t.Fatalf("Expected packet [%+v] found [%+v]", expected, packet)
+	}
+}
+
+func (a *app) send(packet *nony.Packet) {
+	a.t.Helper()
+
+	err := a.packets.Write(context.Background(), packet)
+	if err != nil {
+		a.t.Fatalf("Failed to write packet: %v", err)
+	}
+}
+
+// expectClosed expects the socket to have been closed with the code.
+func (a *app) expectClosed(code websockets.CloseCode) {
+	a.t.Helper()
+
+	select {
+	case err := <-a.err:
+		var closeErr *websockets.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != code {
+			a.t.Errorf("Expected the client to close with [%d] found [%v]", code, err)
+		}
+	case <-time.After(sessionTimeout):
+		a.t.Fatalf("Expected the socket to be closed")
+	}
+}
+
+type session struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+const sessionTimeout = time.Second
+
+// handshake sends an upgrade request for the path and returns the
+// server's response, the session speaks websockets from then on.
+func (s *session) handshake(path string) *http.Response {
+	s.t.Helper()
+
+	request := "GET " + path + " HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		"Sec-WebSocket-Version: 13\r\n" +
+		"\r\n"
+	s.write([]byte(request))
+
+	s.conn.SetReadDeadline(time.Now().Add(sessionTimeout))
+	response, err := http.ReadResponse(s.reader, nil)
+	if err != nil {
+		s.t.Fatalf("Failed to read handshake response: %v", err)
+	}
+
+	return response
+}
+
+func (s *session) join(userId string) {
+	s.send(&nony.Packet{Type: nony.NonyPacketTypeJoin, UserId: userId})
+}
+
+func (s *session) say(userId string, text string) {
+	s.send(&nony.Packet{Type: nony.NonyPacketTypeMessage, UserId: userId, Content: &nony.PacketContent{Text: text}})
+}
+
+func (s *session) send(packet *nony.Packet) {
+	s.t.Helper()
+
+	data, err := nony.CodecFor("").Encode(packet)
+	if err != nil {
+		s.t.Fatalf("Failed to encode packet: %v", err)
+	}
+
+	s.sendFrame(websockets.OpTextFrame, data)
+}
+
+// sendFrame masks the frame the way clients must.
+func (s *session) sendFrame(opCode websockets.FrameOpCode, payload []byte) {
+	s.t.Helper()
+
+	frame := []byte{0x80 | byte(opCode)}
+	if len(payload) < 126 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	}
+
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%len(mask)])
+	}
+
+	s.write(frame)
+}
+
+func (s *session) sendClose(code websockets.CloseCode) {
+	s.sendFrame(websockets.OpConnectionClose, websockets.NewCloseMessage(code, "").Data)
+}
+
+func (s *session) write(data []byte) {
+	s.t.Helper()
+
+	s.conn.SetWriteDeadline(time.Now().Add(sessionTimeout))
+	_, err := s.conn.Write(data)
+	if err != nil {
+		s.t.Fatalf("Failed to write: %v", err)
+	}
+}
+
+// expectFrame reads the next frame the server sent, which must
+// match the expected one byte for byte.
+func (s *session) expectFrame(expected []byte) {
+	s.t.Helper()
+
+	s.conn.SetReadDeadline(time.Now().Add(sessionTimeout))
+	received := make([]byte, len(expected))
+	n, err := io.ReadFull(s.reader, received)
+	if err != nil {
+		s.t.Fatalf("Expected frame [%x] found [%x]: %v", expected, received[:n], err)
+	}
+
+	if !bytes.Equal(received, expected) {
+		s.t.Fatalf("Expected frame [%x] found [%x]", expected, received)
+	}
+}
+
+// expectPacket expects the frame carrying the packet.
+func (s *session) expectPacket(packet *nony.Packet) {
+	s.t.Helper()
+
+	data, err := nony.CodecFor("").Encode(packet)
+	if err != nil {
+		s.t.Fatalf("Failed to encode packet: %v", err)
+	}
+
+	s.expectFrame(websockets.NewFrame(websockets.OpTextFrame, data).Encode())
+}
+
+func (s *session) expectClose(code websockets.CloseCode, reason string) {
+	s.t.Helper()
+
+	message := websockets.NewCloseMessage(code, reason)
+	s.expectFrame(websockets.NewFrame(websockets.OpConnectionClose, message.Data).Encode())
+	s.expectEOF()
+}
+
+func (s *session) expectEOF() {
+	s.t.Helper()
+
+	s.conn.SetReadDeadline(time.Now().Add(sessionTimeout))
+	rest, err := io.ReadAll(s.reader)
+	if err != nil || len(rest) != 0 {
+		s.t.Fatalf("Expected the connection to be closed found [%x] %v", rest, err)
+	}
+}
+
+func TestSessionConversation(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.connect()
+	response := alice.handshake("/chats/lobby")
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status [%d] found [%d]", http.StatusSwitchingProtocols, response.StatusCode)
+	}
+
+	if accept := response.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Expected Sec-WebSocket-Accept [s3pPLMBiTxaQ9kYGzzhZRbK+xOo=] found [%s]", accept)
+	}
+
+	app := h.accept()
+	if roomId := app.request.Params["roomId"]; roomId != "lobby" {
+		t.Errorf("Expected room [lobby] found [%s]", roomId)
+	}
+
+	alice.join("alice")
+	app.expectPacket(&nony.Packet{Type: nony.NonyPacketTypeJoin, UserId: "alice"})
+
+	alice.say("alice", "Hello")
+	app.expectPacket(&nony.Packet{Type: nony.NonyPacketTypeMessage, UserId: "alice", Content: &nony.PacketContent{Text: "Hello"}})
+
+	reply := &nony.Packet{
+		Type:      nony.NonyPacketTypeMessage,
+		UserId:    "bob",
+		RoomId:    "lobby",
+		Content:   &nony.PacketContent{Text: "Hi"},
+		Timestamp: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	app.send(reply)
+	alice.expectPacket(reply)
+
+	// Pings are answered in between packets.
+	alice.sendFrame(websockets.OpPing, []byte("ping"))
+	alice.expectFrame(websockets.NewFrame(websockets.OpPong, []byte("ping")).Encode())
+
+	alice.sendClose(websockets.CloseNormalClosure)
+	alice.expectClose(websockets.CloseNormalClosure, "")
+	app.expectClosed(websockets.CloseNormalClosure)
+}
+
+func TestLineSession(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.connect()
+	alice.handshake("/rooms/lobby")
+	waitForMembers(t, h.rooms, "lobby", 1)
+
+	// Typed in a terminal, without a handshake.
+	bob := h.connectLines()
+	bob.write([]byte(`{"type":"join","userId":"bob","roomId":"lobby"}` + "\r\n"))
+	alice.expectPacket(&nony.Packet{Type: nony.NonyPacketTypeJoin, UserId: "bob", RoomId: "lobby"})
+
+	alice.send(&nony.Packet{
+		Type:      nony.NonyPacketTypeMessage,
+		UserId:    "alice",
+		RoomId:    "lobby",
+		Content:   &nony.PacketContent{Text: "Hello"},
+		Timestamp: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	})
+	bob.expectFrame([]byte(`{"type":"message","userId":"alice","roomId":"lobby","content":{"text":"Hello"},"timestamp":"2025-01-02T03:04:05Z"}` + "\n"))
+
+	bob.write([]byte("not a packet\n"))
+	bob.expectEOF()
+	waitForMembers(t, h.rooms, "lobby", 1)
+}
+
+func TestLineSessionLimits(t *testing.T) {
+	h := newHarness(t)
+	h.lines.SetMaxClients(1)
+	h.lines.SetSocketOptions(func(socket *transport.LineSocket) {
+		socket.SetIdleTimeout(50 * time.Millisecond)
+	})
+
+	alice := h.connectLines()
+	alice.write([]byte(`{"type":"join","userId":"alice","roomId":"lobby"}` + "\n"))
+	waitForMembers(t, h.rooms, "lobby", 1)
+
+	// Turned away while alice is served.
+	h.connectLines().expectEOF()
+
+	// Then alice is dropped for staying silent.
+	alice.expectEOF()
+	waitForMembers(t, h.rooms, "lobby", 0)
+}
+
+func TestSessionRejected(t *testing.T) {
+	cases := []struct {
+		description string
+		script      func(h *harness, s *session)
+	}{
+		{
+			description: "unknown path",
+			script: func(h *harness, s *session) {
+				response := s.handshake("/elsewhere")
+				if response.StatusCode != http.StatusNotFound {
+					h.t.Errorf("Expected status [%d] found [%d]", http.StatusNotFound, response.StatusCode)
+				}
+
+				body, _ := io.ReadAll(response.Body)
+				if string(body) != "Not found: /elsewhere\n" {
+					h.t.Errorf("Expected body [Not found: /elsewhere] found [%s]", body)
+				}
+				s.expectEOF()
+			},
+		},
+		{
+			description: "unmasked frame",
+			script: func(h *harness, s *session) {
+				s.handshake("/chats/lobby")
+				s.write(websockets.NewFrame(websockets.OpTextFrame, []byte("{}")).Encode())
+				s.expectClose(websockets.CloseProtocolError, websockets.ErrUnmaskedClientFrame.Error())
+			},
+		},
+		{
+			description: "message too large",
+			script: func(h *harness, s *session) {
+				s.handshake("/chats/lobby")
+				// The header is enough to refuse the frame, the payload
+				// would never be read.
+				s.write([]byte{0x81, 0x80 | 126, 0x07, 0xd0, 0x12, 0x34, 0x56, 0x78})
+				s.expectClose(websockets.CloseMessageTooBig, websockets.ErrFrameTooLarge.Error())
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			h := newHarness(t)
+			c.script(h, h.connect())
+		})
+	}
+}
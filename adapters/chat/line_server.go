@@ -0,0 +1,80 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+
+	"github.com/shakram02/nony-chat/adapters/protocol/transport"
+)
+
+// LineServer serves clients speaking a JSON packet a line over plain
+// TCP, e.g. `nc`. They name their room in their first packet and share
+// the rooms with websocket clients.
+type LineServer struct {
+	rooms         *Rooms
+	bufferSize    int
+	maxLineLength uint64
+	// Clients served at once, nil doesn't limit.
+	slots     chan struct{}
+	configure func(socket *transport.LineSocket)
+}
+
+func NewLineServer(rooms *Rooms, bufferSize int, maxLineLength uint64) *LineServer {
+	return &LineServer{
+		rooms:         rooms,
+		bufferSize:    bufferSize,
+		maxLineLength: maxLineLength,
+		configure:     func(socket *transport.LineSocket) {},
+	}
+}
+
+// SetSocketOptions configures every socket before it's started,
+// e.g. with a signer or timeouts.
+func (s *LineServer) SetSocketOptions(configure func(socket *transport.LineSocket)) {
+	s.configure = configure
+}
+
+// SetMaxClients caps the clients served at once, more are turned away.
+func (s *LineServer) SetMaxClients(maxClients int) {
+	s.slots = make(chan struct{}, maxClients)
+}
+
+// HandleConnection serves the client until it leaves
+// or the context is cancelled.
+func (s *LineServer) HandleConnection(ctx context.Context, conn net.Conn) {
+	remoteAddr := conn.RemoteAddr().String()
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+			defer func() { <-s.slots }()
+		default:
+			log.Printf("Turning away line client %s: too many clients", remoteAddr)
+			conn.Close()
+			return
+		}
+	}
+
+	socket := transport.NewLineSocket(transport.NewTcp(conn, s.bufferSize), s.maxLineLength)
+	s.configure(socket)
+	defer socket.Close()
+
+	err := socket.Start(ctx)
+	if err != nil {
+		log.Printf("Failed to log in line client %s: %v", remoteAddr, err)
+		return
+	}
+
+	err = s.rooms.Serve(ctx, socket, "")
+
+	// Without framing there's no close code, the reason is only logged.
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, io.EOF):
+	case errors.Is(err, ErrInvalidPacket), errors.Is(err, transport.ErrIdentityMismatch), errors.Is(err, transport.ErrIdleTimeout):
+		log.Printf("Closing line client %s: %v", remoteAddr, err)
+	default:
+		log.Printf("Failed to read line from %s: %v", remoteAddr, err)
+	}
+}
@@ -0,0 +1,142 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/shakram02/nony-chat/adapters/http/router"
+	"github.com/shakram02/nony-chat/adapters/nony"
+	"github.com/shakram02/nony-chat/adapters/protocol/transport"
+	"github.com/shakram02/nony-chat/adapters/websockets"
+)
+
+var ErrInvalidPacket = errors.New("Invalid packet")
+
+// How long a broadcast waits on a single member, a member that
+// can't keep up is dropped rather than stalling the room.
+const broadcastTimeout = time.Second
+
+// Member is a client's connection, whatever carries its packets.
+type Member = transport.Transport[*nony.Packet]
+
+// Rooms relay packets between the clients in a room, whether they're
+// websocket or line clients. Rooms are created when their first member
+// joins and removed once their last member leaves.
+type Rooms struct {
+	mu    sync.Mutex
+	rooms map[string]map[Member]struct{}
+}
+
+func NewRooms() *Rooms {
+	return &Rooms{
+		rooms: map[string]map[Member]struct{}{},
+	}
+}
+
+func (r *Rooms) join(roomId string, member Member) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	room, ok := r.rooms[roomId]
+	if !ok {
+		room = map[Member]struct{}{}
+		r.rooms[roomId] = room
+	}
+
+	room[member] = struct{}{}
+}
+
+func (r *Rooms) leave(roomId string, member Member) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.rooms[roomId], member)
+	if len(r.rooms[roomId]) == 0 {
+		delete(r.rooms, roomId)
+	}
+}
+
+// broadcast sends the packet to every member but its sender. Members
+// are written to outside the lock so a slow one doesn't hold up joins
+// and leaves.
+func (r *Rooms) broadcast(ctx context.Context, roomId string, sender Member, packet *nony.Packet) {
+	r.mu.Lock()
+	members := make([]Member, 0, len(r.rooms[roomId]))
+	for member := range r.rooms[roomId] {
+		if member != sender {
+			members = append(members, member)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, member := range members {
+		writeCtx, cancel := context.WithTimeout(ctx, broadcastTimeout)
+		err := member.Write(writeCtx, packet)
+		cancel()
+
+		// Closing ends the member's session, which leaves the room.
+		if err != nil {
+			member.Close()
+		}
+	}
+}
+
+// Serve relays the client's packets as they are to the other members
+// of its room until the client leaves or the context is cancelled. The
+// room is the one the client connected to, if any, or the one named by
+// its first packet.
+func (r *Rooms) Serve(ctx context.Context, client Member, roomId string) error {
+	joined := ""
+	defer func() {
+		if joined != "" {
+			r.leave(joined, client)
+		}
+	}()
+
+	if roomId != "" {
+		r.join(roomId, client)
+		joined = roomId
+	}
+
+	for {
+		packet, err := client.Read(ctx)
+		if err != nil {
+			return err
+		}
+
+		if packet == nil {
+			return ErrInvalidPacket
+		}
+
+		if joined == "" {
+			if packet.RoomId == "" {
+				return ErrInvalidPacket
+			}
+
+			r.join(packet.RoomId, client)
+			joined = packet.RoomId
+		}
+
+		r.broadcast(ctx, joined, client, packet)
+	}
+}
+
+// HandleSocket serves a websocket client in the rooms, it's meant to be
+// routed to e.g. "/chats/{roomId}".
+func (r *Rooms) HandleSocket(ctx context.Context, nonySocket *transport.NonySocket, request router.Request) {
+	err := r.Serve(ctx, nonySocket, request.Params["roomId"])
+
+	var closeErr *websockets.CloseError
+	switch {
+	case errors.Is(err, context.Canceled):
+		nonySocket.CloseWithCode(websockets.CloseGoingAway, "Server shutting down")
+	case errors.As(err, &closeErr):
+		log.Printf("Client %s closed the connection: %d %s", nonySocket.Client().RemoteAddr, closeErr.Code, closeErr.Reason)
+	default:
+		log.Printf("Failed to read nony packet from %s: %v", nonySocket.Client().RemoteAddr, err)
+		nonySocket.Close()
+	}
+}
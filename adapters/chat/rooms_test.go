@@ -0,0 +1,159 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shakram02/nony-chat/adapters/nony"
+	"github.com/shakram02/nony-chat/adapters/protocol/transport"
+)
+
+// serveMember serves one end of a pipe and returns the other end,
+// the error Serve returns is sent on the channel.
+func serveMember(rooms *Rooms, roomId string) (*transport.Pipe[*nony.Packet], chan error) {
+	client, server := transport.NewPipe[*nony.Packet](8)
+	served := make(chan error, 1)
+	go func() {
+		served <- rooms.Serve(context.Background(), server, roomId)
+		server.Close()
+	}()
+
+	return client, served
+}
+
+func readPacket(t *testing.T, member *transport.Pipe[*nony.Packet]) *nony.Packet {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	packet, err := member.Read(ctx)
+	if err != nil {
+		t.Fatalf("Failed to read packet: %v", err)
+	}
+
+	return packet
+}
+
+// waitForMembers waits for the room to hold that many members, the
+// sessions are served concurrently with the test.
+func waitForMembers(t *testing.T, rooms *Rooms, roomId string, expected int) {
+	t.Helper()
+
+	members := func() int {
+		rooms.mu.Lock()
+		defer rooms.mu.Unlock()
+		return len(rooms.rooms[roomId])
+	}
+
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		if members() == expected {
+			return
+		}
+	}
+
+	t.Fatalf("Expected [%d] members found [%d]", expected, members())
+}
+
+func TestRoomsBroadcast(t *testing.T) {
+	rooms := NewRooms()
+	ctx := context.Background()
+
+	alice, _ := serveMember(rooms, "")
+	alice.Write(ctx, &nony.Packet{Type: nony.NonyPacketTypeJoin, UserId: "alice", RoomId: "lobby"})
+	waitForMembers(t, rooms, "lobby", 1)
+
+	// The room in the path wins over the one in the packet, which is
+	// relayed as is.
+	bob, _ := serveMember(rooms, "lobby")
+	waitForMembers(t, rooms, "lobby", 2)
+	joined := &nony.Packet{Type: nony.NonyPacketTypeJoin, UserId: "bob", RoomId: "elsewhere"}
+	bob.Write(ctx, joined)
+	if packet := readPacket(t, alice); !reflect.DeepEqual(packet, joined) {
+		t.Errorf("Expected [%+v] found [%+v]", joined, packet)
+	}
+
+	message := &nony.Packet{Type: nony.NonyPacketTypeMessage, UserId: "alice", RoomId: "lobby", Content: &nony.PacketContent{Text: "hi"}}
+	alice.Write(ctx, message)
+	if packet := readPacket(t, bob); !reflect.DeepEqual(packet, message) {
+		t.Errorf("Expected [%+v] found [%+v]", message, packet)
+	}
+}
+
+func TestRoomsLeave(t *testing.T) {
+	rooms := NewRooms()
+
+	alice, served := serveMember(rooms, "lobby")
+	waitForMembers(t, rooms, "lobby", 1)
+	alice.Close()
+
+	err := <-served
+	if !errors.Is(err, transport.ErrClosed) {
+		t.Errorf("Expected [%v] found [%v]", transport.ErrClosed, err)
+	}
+
+	waitForMembers(t, rooms, "lobby", 0)
+}
+
+func TestRoomsDropSlowMember(t *testing.T) {
+	rooms := NewRooms()
+
+	// Bob stopped reading, nothing written to him is taken.
+	_, bob := transport.NewPipe[*nony.Packet](0)
+	bobServed := make(chan error, 1)
+	go func() {
+		bobServed <- rooms.Serve(context.Background(), bob, "lobby")
+	}()
+
+	alice, _ := serveMember(rooms, "lobby")
+	waitForMembers(t, rooms, "lobby", 2)
+	alice.Write(context.Background(), &nony.Packet{Type: nony.NonyPacketTypeMessage, UserId: "alice"})
+
+	select {
+	case err := <-bobServed:
+		if !errors.Is(err, transport.ErrClosed) {
+			t.Errorf("Expected [%v] found [%v]", transport.ErrClosed, err)
+		}
+	case <-time.After(2 * broadcastTimeout):
+		t.Fatalf("Expected bob to be dropped")
+	}
+
+	waitForMembers(t, rooms, "lobby", 1)
+}
+
+func TestRoomsErrors(t *testing.T) {
+	cases := []struct {
+		description string
+		roomId      string
+		packet      *nony.Packet
+	}{
+		{
+			description: "no room",
+			packet:      &nony.Packet{Type: nony.NonyPacketTypeJoin, UserId: "bob"},
+		},
+		{
+			description: "undecodable packet",
+			roomId:      "lobby",
+			packet:      nil,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			bob, served := serveMember(NewRooms(), c.roomId)
+			bob.Write(context.Background(), c.packet)
+
+			select {
+			case err := <-served:
+				if !errors.Is(err, ErrInvalidPacket) {
+					t.Errorf("Expected [%v] found [%v]", ErrInvalidPacket, err)
+				}
+			case <-time.After(time.Second):
+				t.Errorf("Expected [%v], the session is still served", ErrInvalidPacket)
+			}
+		})
+	}
+}
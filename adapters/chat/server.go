@@ -0,0 +1,65 @@
+// Package chat serves chat clients from the handshake on, handing
+// each to the handler of the path it connected to.
+package chat
+
+import (
+	"context"
+	"log"
+	"net"
+
+	"github.com/shakram02/nony-chat/adapters/http/router"
+	"github.com/shakram02/nony-chat/adapters/protocol/transport"
+)
+
+// Server runs websocket connections from the handshake on and
+// routes them to their handlers.
+type Server struct {
+	routes         *router.Router[transport.Handler]
+	bufferSize     int
+	maxMessageSize uint64
+	configure      func(socket *transport.NonySocket)
+}
+
+func NewServer(bufferSize int, maxMessageSize uint64) *Server {
+	return &Server{
+		routes:         router.New[transport.Handler](),
+		bufferSize:     bufferSize,
+		maxMessageSize: maxMessageSize,
+		configure:      func(socket *transport.NonySocket) {},
+	}
+}
+
+// Handle serves the sockets connecting to paths matching the pattern,
+// e.g. "/chats/{roomId}".
+func (s *Server) Handle(pattern string, handler transport.Handler) {
+	s.routes.Handle(pattern, handler)
+}
+
+// SetSocketOptions configures every socket before its handshake,
+// e.g. with an origin policy or an authenticator.
+func (s *Server) SetSocketOptions(configure func(socket *transport.NonySocket)) {
+	s.configure = configure
+}
+
+// HandleConnection handshakes the client then serves it until it
+// leaves or the context is cancelled.
+func (s *Server) HandleConnection(ctx context.Context, conn net.Conn) {
+	tcpTransport := transport.NewTcp(conn, s.bufferSize)
+	nonySocket := transport.NewNony(tcpTransport, s.maxMessageSize)
+	s.configure(nonySocket)
+	nonySocket.SetRouter(s.routes)
+
+	err := nonySocket.Start(ctx)
+	if err != nil {
+		remoteAddr := nonySocket.Client().RemoteAddr
+		if remoteAddr == "" {
+			remoteAddr = conn.RemoteAddr().String()
+		}
+
+		log.Printf("Failed to handshake client %s: %v", remoteAddr, err)
+		return
+	}
+
+	handler, request := nonySocket.Route()
+	handler(ctx, nonySocket, request)
+}
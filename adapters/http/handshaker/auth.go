@@ -0,0 +1,83 @@
+package handshaker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/shakram02/nony-chat/adapters/auth"
+	http_parser "github.com/shakram02/nony-chat/adapters/http/parser"
+)
+
+var (
+	ErrUnauthorized = errors.New("Unauthorized")
+	ErrMissingToken = fmt.Errorf("%w: missing token", ErrUnauthorized)
+)
+
+const (
+	TokenQueryParam = "token"
+	TokenCookie     = "nony_token"
+	// Browsers can't set handshake headers, so they may offer the
+	// token as a "token.<token>" subprotocol next to a real one.
+	TokenProtocolPrefix = "token."
+)
+
+// TokenAuthenticator verifies the signed token a client sends with its
+// handshake, in the query string, a cookie or Sec-WebSocket-Protocol.
+type TokenAuthenticator struct {
+	signer *auth.Signer
+}
+
+func NewTokenAuthenticator(signer *auth.Signer) *TokenAuthenticator {
+	return &TokenAuthenticator{signer: signer}
+}
+
+func (a *TokenAuthenticator) Authenticate(clientHandshake http_parser.WebsocketHandshake) (auth.Identity, error) {
+	token := findToken(clientHandshake)
+	if token == "" {
+		return auth.Identity{}, ErrMissingToken
+	}
+
+	identity, err := a.signer.Verify(token)
+	if err != nil {
+		return auth.Identity{}, fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+
+	return identity, nil
+}
+
+func findToken(clientHandshake http_parser.WebsocketHandshake) string {
+	requestUrl, err := url.ParseRequestURI(clientHandshake.RequestLine.Uri)
+	if err == nil {
+		token := requestUrl.Query().Get(TokenQueryParam)
+		if token != "" {
+			return token
+		}
+	}
+
+	for _, line := range clientHandshake.Fields.Values("Cookie") {
+		cookies, err := http.ParseCookie(line)
+		if err != nil {
+			continue
+		}
+
+		for _, cookie := range cookies {
+			if cookie.Name == TokenCookie && cookie.Value != "" {
+				return cookie.Value
+			}
+		}
+	}
+
+	for _, value := range clientHandshake.Fields.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(value, ",") {
+			token, isToken := strings.CutPrefix(strings.TrimSpace(protocol), TokenProtocolPrefix)
+			if isToken && token != "" {
+				return token
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,87 @@
+package handshaker
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/shakram02/nony-chat/adapters/auth"
+	http_parser "github.com/shakram02/nony-chat/adapters/http/parser"
+)
+
+func TestTokenAuthenticator(t *testing.T) {
+	signer := auth.NewSigner([]byte("secret"))
+	token, err := signer.Sign("alice", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	forged, _ := auth.NewSigner([]byte("forged")).Sign("mallory", time.Hour)
+
+	cases := []struct {
+		description string
+		uri         string
+		fields      http.Header
+		err         error
+	}{
+		{
+			description: "Query parameter",
+			uri:         "/chats?token=" + token,
+		},
+		{
+			description: "Cookie",
+			uri:         "/chats",
+			fields:      http.Header{"Cookie": {"theme=dark; " + TokenCookie + "=" + token}},
+		},
+		{
+			description: "Subprotocol",
+			uri:         "/chats",
+			fields:      http.Header{"Sec-Websocket-Protocol": {"nony.v1.json, " + TokenProtocolPrefix + token}},
+		},
+		{
+			description: "Missing token",
+			uri:         "/chats?token=",
+			fields:      http.Header{"Cookie": {"theme=dark"}},
+			err:         ErrMissingToken,
+		},
+		{
+			description: "Forged token",
+			uri:         "/chats?token=" + forged,
+			err:         auth.ErrBadSignature,
+		},
+	}
+
+	authenticator := NewTokenAuthenticator(signer)
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			fields := c.fields
+			if fields == nil {
+				fields = http.Header{}
+			}
+
+			identity, err := authenticator.Authenticate(http_parser.WebsocketHandshake{
+				RequestLine: http_parser.HandshakeRequestLine{Uri: c.uri},
+				Fields:      fields,
+			})
+
+			if c.err != nil {
+				if !errors.Is(err, c.err) {
+					t.Errorf("Expected error: %v, got: %v", c.err, err)
+				}
+
+				if StatusFor(err) != http.StatusUnauthorized {
+					t.Errorf("Expected status 401, got: %d", StatusFor(err))
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if identity.UserId != "alice" {
+				t.Errorf("Expected user alice, got: %s", identity.UserId)
+			}
+		})
+	}
+}
@@ -1,27 +1,27 @@
 package handshaker
 
 import (
-	"crypto/sha1"
-	"encoding/base64"
-	"strings"
-
 	http_parser "github.com/shakram02/nony-chat/adapters/http/parser"
+	"github.com/shakram02/nony-chat/adapters/websockets"
 )
 
-// https://datatracker.ietf.org/doc/html/rfc6455#section-4.1
-// If the response lacks a |Sec-WebSocket-Accept| header field or
-// the |Sec-WebSocket-Accept| contains a value other than the
-// base64-encoded SHA-1 of the concatenation of the |Sec-WebSocket-
-// Key| (as a string, not base64-decoded) with the string "258EAFA5-
-// E914-47DA-95CA-C5AB0DC85B11" but ignoring any leading and
-// trailing whitespace, the client MUST _Fail the WebSocket
-// Connection_.
-const rfc6455ServerResponseGuid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
 const lineSep = "\r\n"
 
 type handshakeResponse struct {
 	ClientUuid      string
 	WebsocketAccept string
+	Extensions      string
+	Protocol        string
+}
+
+// AcceptOptions holds what was negotiated with the client
+// on top of the plain handshake.
+type AcceptOptions struct {
+	// Value of the Sec-WebSocket-Extensions response header,
+	// omitted if empty.
+	Extensions string
+	// The chosen subprotocol, omitted if empty.
+	Protocol string
 }
 
 type HandshakedClient struct {
@@ -29,9 +29,11 @@ type HandshakedClient struct {
 	SocketIdentifier string
 }
 
-func MakeAcceptanceResposne(clientHandshake http_parser.WebsocketHandshake) []byte {
-	websocketAccept := makeHandshakeAcceptHeaderValue(clientHandshake.Headers.SecWebSocketKey)
-	return makeResponse(websocketAccept)
+func MakeAcceptanceResposne(clientHandshake http_parser.WebsocketHandshake, options AcceptOptions) []byte {
+	response := makeHandshakeAcceptHeaderValue(clientHandshake.Headers.SecWebSocketKey)
+	response.Extensions = options.Extensions
+	response.Protocol = options.Protocol
+	return makeResponse(response)
 }
 
 func makeResponse(resp handshakeResponse) []byte {
@@ -40,28 +42,20 @@ func makeResponse(resp handshakeResponse) []byte {
 	responseString += "Upgrade: websocket" + lineSep
 	responseString += "Connection: Upgrade" + lineSep
 	responseString += "Sec-WebSocket-Accept: " + resp.WebsocketAccept + lineSep
+	if resp.Extensions != "" {
+		responseString += "Sec-WebSocket-Extensions: " + resp.Extensions + lineSep
+	}
+	if resp.Protocol != "" {
+		responseString += "Sec-WebSocket-Protocol: " + resp.Protocol + lineSep
+	}
 	responseString += lineSep
 
 	return []byte(responseString)
 }
 
 func makeHandshakeAcceptHeaderValue(websocketKey string) handshakeResponse {
-	trimmed := strings.TrimSpace(websocketKey)
-	handshakeAccept := trimmed + rfc6455ServerResponseGuid
-	hasher := sha1.New()
-	hasher.Write([]byte(handshakeAccept))
-	data := hasher.Sum(nil)
-
-	dst := make([]byte, base64.StdEncoding.EncodedLen(len(data)))
-	base64.StdEncoding.Encode(dst, data)
-
 	return handshakeResponse{
 		ClientUuid:      websocketKey,
-		WebsocketAccept: string(dst),
+		WebsocketAccept: websockets.ComputeAcceptKey(websocketKey),
 	}
 }
-
-func MakeRejectionResponse() []byte {
-	responseString := "HTTP/1.1 400 Bad Request\r\n\r\n"
-	return []byte(responseString)
-}
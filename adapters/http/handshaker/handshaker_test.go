@@ -1,7 +1,10 @@
 package handshaker
 
 import (
+	"strings"
 	"testing"
+
+	http_parser "github.com/shakram02/nony-chat/adapters/http/parser"
 )
 
 func TestHandshakeResponse(t *testing.T) {
@@ -13,3 +16,54 @@ func TestHandshakeResponse(t *testing.T) {
 		t.Errorf("Expected websocket accept to be s3pPLMBiTxaQ9kYGzzhZRbK+xOo=, got %s", response.WebsocketAccept)
 	}
 }
+
+func TestAcceptanceResponseOptions(t *testing.T) {
+	clientHandshake := http_parser.WebsocketHandshake{
+		Headers: http_parser.HandshakeHeaders{SecWebSocketKey: "dGhlIHNhbXBsZSBub25jZQ=="},
+	}
+
+	cases := []struct {
+		description string
+		options     AcceptOptions
+		contains    []string
+		omits       []string
+	}{
+		{
+			description: "Plain handshake",
+			omits:       []string{"Sec-WebSocket-Extensions", "Sec-WebSocket-Protocol"},
+		},
+		{
+			description: "Negotiated subprotocol",
+			options:     AcceptOptions{Protocol: "nony.v1.json"},
+			contains:    []string{"\r\nSec-WebSocket-Protocol: nony.v1.json\r\n"},
+			omits:       []string{"Sec-WebSocket-Extensions"},
+		},
+		{
+			description: "Negotiated extension",
+			options:     AcceptOptions{Extensions: "permessage-deflate"},
+			contains:    []string{"\r\nSec-WebSocket-Extensions: permessage-deflate\r\n"},
+			omits:       []string{"Sec-WebSocket-Protocol"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			response := string(MakeAcceptanceResposne(clientHandshake, c.options))
+			if !strings.HasPrefix(response, "HTTP/1.1 101 Switching Protocols\r\n") || !strings.HasSuffix(response, "\r\n\r\n") {
+				t.Errorf("Malformed response: %q", response)
+			}
+
+			for _, header := range c.contains {
+				if !strings.Contains(response, header) {
+					t.Errorf("Expected %q in response: %q", header, response)
+				}
+			}
+
+			for _, header := range c.omits {
+				if strings.Contains(response, header) {
+					t.Errorf("Unexpected %q in response: %q", header, response)
+				}
+			}
+		})
+	}
+}
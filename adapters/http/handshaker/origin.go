@@ -0,0 +1,78 @@
+package handshaker
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	http_parser "github.com/shakram02/nony-chat/adapters/http/parser"
+)
+
+var ErrOriginNotAllowed = fmt.Errorf("%w: origin not allowed", ErrForbidden)
+
+// OriginPolicy decides which web pages may open a socket, browsers send
+// the page's origin so other sites can't connect on a visitor's behalf.
+// https://datatracker.ietf.org/doc/html/rfc6455#section-10.2
+type OriginPolicy struct {
+	// Hosts allowed to connect, e.g. "chat.example.com", or
+	// "*.example.com" for any subdomain of example.com. A host
+	// with a port only matches that port.
+	AllowedHosts []string
+	// Allows origins on the host the client connected to.
+	AllowSameHost bool
+	// Allows clients that send no Origin, which browsers
+	// always send, e.g. bots and CLI clients.
+	AllowMissingOrigin bool
+}
+
+func (p *OriginPolicy) Check(clientHandshake http_parser.WebsocketHandshake) error {
+	origin := clientHandshake.Headers.Origin
+	if origin == "" {
+		if p.AllowMissingOrigin {
+			return nil
+		}
+
+		return fmt.Errorf("%w: missing origin", ErrOriginNotAllowed)
+	}
+
+	originUrl, err := url.Parse(origin)
+	if err != nil || originUrl.Host == "" {
+		return fmt.Errorf("%w: %s", ErrOriginNotAllowed, origin)
+	}
+
+	if p.AllowSameHost && strings.EqualFold(originUrl.Hostname(), hostname(clientHandshake.Headers.Host)) {
+		return nil
+	}
+
+	for _, allowed := range p.AllowedHosts {
+		if matchHost(allowed, originUrl) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrOriginNotAllowed, origin)
+}
+
+func matchHost(pattern string, originUrl *url.URL) bool {
+	host := originUrl.Hostname()
+	if strings.Contains(pattern, ":") {
+		host = originUrl.Host
+	}
+
+	if suffix, isWildcard := strings.CutPrefix(pattern, "*."); isWildcard {
+		return len(host) > len(suffix)+1 && strings.HasSuffix(strings.ToLower(host), "."+strings.ToLower(suffix))
+	}
+
+	return strings.EqualFold(host, pattern)
+}
+
+// hostname strips the port from a Host header value.
+func hostname(host string) string {
+	name, _, err := net.SplitHostPort(host)
+	if err != nil {
+		return strings.Trim(host, "[]")
+	}
+
+	return name
+}
@@ -0,0 +1,130 @@
+package handshaker
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	http_parser "github.com/shakram02/nony-chat/adapters/http/parser"
+)
+
+func TestOriginPolicy(t *testing.T) {
+	cases := []struct {
+		description string
+		policy      OriginPolicy
+		host        string
+		origin      string
+		allowed     bool
+	}{
+		{
+			description: "Exact host",
+			policy:      OriginPolicy{AllowedHosts: []string{"chat.example.com"}},
+			origin:      "https://chat.example.com",
+			allowed:     true,
+		},
+		{
+			description: "Exact host ignores the case",
+			policy:      OriginPolicy{AllowedHosts: []string{"chat.example.com"}},
+			origin:      "https://CHAT.example.com:8443",
+			allowed:     true,
+		},
+		{
+			description: "Exact host with port",
+			policy:      OriginPolicy{AllowedHosts: []string{"chat.example.com:8443"}},
+			origin:      "https://chat.example.com",
+			allowed:     false,
+		},
+		{
+			description: "Unlisted host",
+			policy:      OriginPolicy{AllowedHosts: []string{"chat.example.com"}},
+			origin:      "https://evil.com",
+			allowed:     false,
+		},
+		{
+			description: "Lookalike host",
+			policy:      OriginPolicy{AllowedHosts: []string{"example.com"}},
+			origin:      "https://evilexample.com",
+			allowed:     false,
+		},
+		{
+			description: "Wildcard subdomain",
+			policy:      OriginPolicy{AllowedHosts: []string{"*.example.com"}},
+			origin:      "https://a.b.example.com",
+			allowed:     true,
+		},
+		{
+			description: "Wildcard doesn't match the apex",
+			policy:      OriginPolicy{AllowedHosts: []string{"*.example.com"}},
+			origin:      "https://example.com",
+			allowed:     false,
+		},
+		{
+			description: "Wildcard lookalike",
+			policy:      OriginPolicy{AllowedHosts: []string{"*.example.com"}},
+			origin:      "https://evilexample.com",
+			allowed:     false,
+		},
+		{
+			description: "Same host on another port",
+			policy:      OriginPolicy{AllowSameHost: true},
+			host:        "localhost:8080",
+			origin:      "http://localhost:8000",
+			allowed:     true,
+		},
+		{
+			description: "Same host IPv6",
+			policy:      OriginPolicy{AllowSameHost: true},
+			host:        "[::1]",
+			origin:      "http://[::1]:8000",
+			allowed:     true,
+		},
+		{
+			description: "Other host",
+			policy:      OriginPolicy{AllowSameHost: true},
+			host:        "localhost:8080",
+			origin:      "http://evil.com",
+			allowed:     false,
+		},
+		{
+			description: "Opaque origin",
+			policy:      OriginPolicy{AllowSameHost: true},
+			host:        "localhost:8080",
+			origin:      "null",
+			allowed:     false,
+		},
+		{
+			description: "Missing origin",
+			policy:      OriginPolicy{AllowSameHost: true},
+			host:        "localhost:8080",
+			allowed:     false,
+		},
+		{
+			description: "Missing origin allowed",
+			policy:      OriginPolicy{AllowMissingOrigin: true},
+			allowed:     true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			clientHandshake := http_parser.WebsocketHandshake{
+				Headers: http_parser.HandshakeHeaders{Host: c.host, Origin: c.origin},
+			}
+
+			err := c.policy.Check(clientHandshake)
+			if c.allowed && err != nil {
+				t.Errorf("Expected origin %s to be allowed, got: %v", c.origin, err)
+			}
+
+			if !c.allowed {
+				if !errors.Is(err, ErrOriginNotAllowed) {
+					t.Errorf("Expected origin %s to be rejected, got: %v", c.origin, err)
+				}
+
+				if StatusFor(err) != http.StatusForbidden {
+					t.Errorf("Expected status 403, got: %d", StatusFor(err))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package handshaker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	http_parser "github.com/shakram02/nony-chat/adapters/http/parser"
+	"github.com/shakram02/nony-chat/adapters/http/router"
+)
+
+// ErrForbidden is wrapped by policy errors that refuse
+// an otherwise valid handshake.
+var ErrForbidden = errors.New("Forbidden")
+
+var ErrTooManyHandshakes = errors.New("Too many pending handshakes")
+
+// MakeRejectionResponse answers a failed handshake with the status its error
+// maps to and a short text body, so the reason shows up in browser devtools.
+func MakeRejectionResponse(err error) []byte {
+	status := StatusFor(err)
+
+	responseString := fmt.Sprintf("HTTP/1.1 %d %s", status, http.StatusText(status)) + lineSep
+	switch status {
+	case http.StatusUpgradeRequired:
+		// https://datatracker.ietf.org/doc/html/rfc6455#section-4.4
+		// The server MUST include the versions it supports in a
+		// |Sec-WebSocket-Version| header field.
+		responseString += "Upgrade: websocket" + lineSep
+		responseString += "Sec-WebSocket-Version: 13" + lineSep
+	case http.StatusMethodNotAllowed:
+		responseString += "Allow: GET" + lineSep
+	}
+
+	body := rejectionReason(err, status) + "\n"
+	responseString += "Content-Type: text/plain; charset=utf-8" + lineSep
+	responseString += "Content-Length: " + strconv.Itoa(len(body)) + lineSep
+	responseString += "Connection: close" + lineSep
+	responseString += lineSep
+	responseString += body
+
+	return []byte(responseString)
+}
+
+// StatusFor returns the status a failed handshake is answered with.
+func StatusFor(err error) int {
+	if errors.Is(err, ErrUnauthorized) {
+		return http.StatusUnauthorized
+	}
+
+	if errors.Is(err, ErrForbidden) {
+		return http.StatusForbidden
+	}
+
+	if errors.Is(err, router.ErrNotFound) {
+		return http.StatusNotFound
+	}
+
+	if errors.Is(err, ErrTooManyHandshakes) {
+		return http.StatusServiceUnavailable
+	}
+
+	return http_parser.StatusFor(err)
+}
+
+// rejectionReason explains errors the client caused, other errors
+// (e.g. failed reads) aren't leaked to the client.
+func rejectionReason(err error, status int) string {
+	var requestErr *http_parser.RequestError
+	if errors.As(err, &requestErr) {
+		if requestErr.Reason == "" {
+			return requestErr.Err.Error()
+		}
+
+		return requestErr.Err.Error() + ": " + requestErr.Reason
+	}
+
+	if errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrForbidden) || errors.Is(err, router.ErrNotFound) || errors.Is(err, ErrTooManyHandshakes) {
+		return err.Error()
+	}
+
+	return http.StatusText(status)
+}
@@ -0,0 +1,108 @@
+package handshaker
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	http_parser "github.com/shakram02/nony-chat/adapters/http/parser"
+	"github.com/shakram02/nony-chat/adapters/http/router"
+)
+
+func TestMakeRejectionResponse(t *testing.T) {
+	headers := "Host: astro\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: kBQW2M+CkClJ1bvTT8O4LA==\r\n"
+
+	cases := []struct {
+		description string
+		err         error
+		status      int
+		header      string
+		headerValue string
+		body        string
+	}{
+		{
+			description: "Wrong websocket version",
+			err:         parseError("GET / HTTP/1.1\r\n" + headers + "Sec-WebSocket-Version: 8\r\n\r\n"),
+			status:      http.StatusUpgradeRequired,
+			header:      "Sec-WebSocket-Version",
+			headerValue: "13",
+			body:        "Unsupported websocket version: 8\n",
+		},
+		{
+			description: "Wrong method",
+			err:         parseError("POST / HTTP/1.1\r\n" + headers + "\r\n"),
+			status:      http.StatusMethodNotAllowed,
+			header:      "Allow",
+			headerValue: "GET",
+			body:        "Method not allowed: POST\n",
+		},
+		{
+			description: "Missing header",
+			err:         parseError("GET / HTTP/1.1\r\nHost: astro\r\n\r\n"),
+			status:      http.StatusBadRequest,
+			body:        "Missing or invalid header: Upgrade\n",
+		},
+		{
+			description: "Forbidden",
+			err:         fmt.Errorf("%w: origin not allowed", ErrForbidden),
+			status:      http.StatusForbidden,
+			body:        "Forbidden: origin not allowed\n",
+		},
+		{
+			description: "Unknown path",
+			err:         fmt.Errorf("%w: /admin", router.ErrNotFound),
+			status:      http.StatusNotFound,
+			body:        "Not found: /admin\n",
+		},
+		{
+			description: "Overloaded",
+			err:         ErrTooManyHandshakes,
+			status:      http.StatusServiceUnavailable,
+			body:        "Too many pending handshakes\n",
+		},
+		{
+			description: "Internal errors aren't leaked",
+			err:         errors.New("read tcp 10.0.0.1: connection reset"),
+			status:      http.StatusBadRequest,
+			body:        "Bad Request\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			raw := MakeRejectionResponse(c.err)
+			response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), nil)
+			if err != nil {
+				t.Fatalf("Invalid response %q: %v", raw, err)
+			}
+
+			if response.StatusCode != c.status {
+				t.Errorf("Expected status: %d, got: %d", c.status, response.StatusCode)
+			}
+
+			if c.header != "" && response.Header.Get(c.header) != c.headerValue {
+				t.Errorf("Expected %s: %s, got: %s", c.header, c.headerValue, response.Header.Get(c.header))
+			}
+
+			if !strings.HasPrefix(response.Header.Get("Content-Type"), "text/plain") {
+				t.Errorf("Expected a text body, got: %s", response.Header.Get("Content-Type"))
+			}
+
+			body, _ := io.ReadAll(response.Body)
+			if string(body) != c.body {
+				t.Errorf("Expected body: %q, got: %q", c.body, body)
+			}
+		})
+	}
+}
+
+func parseError(request string) error {
+	_, err := http_parser.ParseUpgradeRequest([]byte(request))
+	return err
+}
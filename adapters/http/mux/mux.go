@@ -0,0 +1,275 @@
+package mux
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	http_parser "github.com/shakram02/nony-chat/adapters/http/parser"
+	"github.com/shakram02/nony-chat/adapters/metrics"
+)
+
+// DefaultMaxHeadSize bounds the bytes read while looking for the end of
+// a request's head, longer heads are handed to the plain HTTP listener.
+const DefaultMaxHeadSize = http_parser.DefaultMaxRequestLineSize + http_parser.DefaultMaxHeaderSize
+
+// Mux serves websockets and plain HTTP on a single port. It peeks at the
+// head of the first request of each connection, websocket upgrades are
+// accepted from Upgrades() and everything else from Plain(), e.g. by an
+// http.Server. The peeked bytes are replayed to whoever reads the connection.
+type Mux struct {
+	listener    net.Listener
+	maxHeadSize int
+	headTimeout time.Duration
+	// Slots of the heads being read, unlimited if nil.
+	pending  chan struct{}
+	upgrades *muxListener
+	plain    *muxListener
+}
+
+func NewMux(listener net.Listener, maxHeadSize int) *Mux {
+	return &Mux{
+		listener:    listener,
+		maxHeadSize: maxHeadSize,
+		upgrades:    newMuxListener(listener.Addr()),
+		plain:       newMuxListener(listener.Addr()),
+	}
+}
+
+// SetHeadTimeout bounds how long a client may take to send its request
+// head, connections that don't make it are dropped. No timeout if zero.
+func (m *Mux) SetHeadTimeout(timeout time.Duration) {
+	m.headTimeout = timeout
+}
+
+// SetMaxPending caps the connections whose head is being read at once,
+// more are dropped as they're accepted. Unlimited if zero.
+func (m *Mux) SetMaxPending(maxPending int) {
+	m.pending = nil
+	if maxPending > 0 {
+		m.pending = make(chan struct{}, maxPending)
+	}
+}
+
+func (m *Mux) Upgrades() net.Listener {
+	return m.upgrades
+}
+
+func (m *Mux) Plain() net.Listener {
+	return m.plain
+}
+
+// Longest wait before accepting again after a failure.
+const maxAcceptDelay = time.Second
+
+// Serve accepts connections until the listener is closed. Other accept
+// failures, e.g. running out of file descriptors, are retried with a
+// growing delay, the way http.Server does.
+func (m *Mux) Serve() error {
+	defer m.upgrades.Close()
+	defer m.plain.Close()
+
+	var delay time.Duration
+	for {
+		conn, err := m.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return err
+		}
+
+		if err != nil {
+			delay = min(max(2*delay, 5*time.Millisecond), maxAcceptDelay)
+			log.Printf("Failed to accept: %v, retrying in %v", err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+
+		if !m.tryEnter() {
+			metrics.ShedHeads.Add(1)
+			conn.Close()
+			continue
+		}
+
+		go m.dispatch(conn)
+	}
+}
+
+func (m *Mux) tryEnter() bool {
+	if m.pending == nil {
+		return true
+	}
+
+	select {
+	case m.pending <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *Mux) leave() {
+	if m.pending != nil {
+		<-m.pending
+	}
+}
+
+func (m *Mux) Close() error {
+	return m.listener.Close()
+}
+
+func (m *Mux) dispatch(conn net.Conn) {
+	if m.headTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(m.headTimeout))
+	}
+
+	head, err := readHead(conn, m.maxHeadSize)
+	// The slot only covers reading the head, connections waiting
+	// to be accepted are bounded by whoever accepts them.
+	m.leave()
+
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		// Plain requests timing out aren't handshakes.
+		if hasUpgradeHeader(head) {
+			metrics.TimedOutHandshakes.Add(1)
+		}
+		conn.Close()
+		return
+	}
+
+	if len(head) == 0 && err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	replayed := &replayConn{Conn: conn, reader: io.MultiReader(bytes.NewReader(head), conn)}
+	if isUpgradeRequest(head) {
+		m.upgrades.push(replayed)
+	} else {
+		m.plain.push(replayed)
+	}
+}
+
+// readHead reads until the empty line ending the request's head,
+// or until maxHeadSize bytes were read.
+func readHead(conn net.Conn, maxHeadSize int) ([]byte, error) {
+	head := make([]byte, 0, 1024)
+	buffer := make([]byte, 1024)
+	for len(head) < maxHeadSize {
+		n, err := conn.Read(buffer[:min(len(buffer), maxHeadSize-len(head))])
+		head = append(head, buffer[:n]...)
+		if bytes.Contains(head, []byte("\r\n\r\n")) {
+			return head, nil
+		}
+
+		if err != nil {
+			return head, err
+		}
+	}
+
+	return head, nil
+}
+
+// hasUpgradeHeader tells if a head, even a partial one, asked for a
+// websocket in the header lines received so far.
+func hasUpgradeHeader(head []byte) bool {
+	lines := strings.Split(string(head), "\r\n")
+	for _, line := range lines[1:] {
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Upgrade") && hasWebsocketToken(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isUpgradeRequest detects clients asking for a websocket, whether or not
+// the request is a valid handshake, invalid ones are rejected by the
+// handshaker with a proper reason.
+func isUpgradeRequest(head []byte) bool {
+	request, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(head)))
+	if err != nil {
+		return false
+	}
+
+	for _, value := range request.Header.Values("Upgrade") {
+		if hasWebsocketToken(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasWebsocketToken(value string) bool {
+	for _, token := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(token), "websocket") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// replayConn reads the peeked bytes again before the rest of the connection.
+type replayConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *replayConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+type muxListener struct {
+	addr      net.Addr
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newMuxListener(addr net.Addr) *muxListener {
+	return &muxListener{
+		addr:  addr,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *muxListener) push(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *muxListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *muxListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+
+	return nil
+}
+
+func (l *muxListener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,231 @@
+package mux
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/shakram02/nony-chat/adapters/metrics"
+)
+
+func startMux(t *testing.T, headTimeout time.Duration, maxPending int) *Mux {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	m := NewMux(listener, DefaultMaxHeadSize)
+	m.SetHeadTimeout(headTimeout)
+	m.SetMaxPending(maxPending)
+	go m.Serve()
+	go http.Serve(m.Plain(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "static "+r.URL.Path)
+	}))
+	t.Cleanup(func() { m.Close() })
+
+	return m
+}
+
+func TestMuxPlainRequest(t *testing.T) {
+	m := startMux(t, 0, 0)
+
+	response, err := http.Get("http://" + m.listener.Addr().String() + "/index.html")
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	defer response.Body.Close()
+
+	body, _ := io.ReadAll(response.Body)
+	if string(body) != "static /index.html" {
+		t.Errorf("Expected the plain handler's body, got: %s", body)
+	}
+}
+
+func TestMuxUpgradeRequest(t *testing.T) {
+	m := startMux(t, 0, 0)
+
+	conn, err := net.Dial("tcp", m.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	// Split across writes, with a frame right after the head.
+	parts := []string{
+		"GET /chats HTTP/1.1\r\nHost: astro\r\nupgrade: ",
+		"WebSocket\r\nConnection: Upgrade\r\n\r\n\x81\x05hello",
+	}
+	for _, part := range parts {
+		conn.Write([]byte(part))
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	accepted, err := m.Upgrades().Accept()
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+	defer accepted.Close()
+
+	expected := parts[0] + parts[1]
+	received := make([]byte, len(expected))
+	_, err = io.ReadFull(accepted, received)
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+
+	if string(received) != expected {
+		t.Errorf("Expected the peeked bytes to be replayed, got: %q", received)
+	}
+}
+
+func TestMuxClose(t *testing.T) {
+	m := startMux(t, 0, 0)
+	m.Close()
+
+	_, err := m.Upgrades().Accept()
+	if !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected closed listener, got: %v", err)
+	}
+}
+
+// flakyListener fails the accepts it's given errors for, then accepts
+// from its listener.
+type flakyListener struct {
+	net.Listener
+	errs chan error
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	select {
+	case err := <-l.errs:
+		return nil, err
+	default:
+		return l.Listener.Accept()
+	}
+}
+
+func TestMuxAcceptRetry(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	errs := make(chan error, 2)
+	errs <- syscall.EMFILE
+	errs <- syscall.EMFILE
+	m := NewMux(&flakyListener{Listener: listener, errs: errs}, DefaultMaxHeadSize)
+
+	served := make(chan error, 1)
+	go func() { served <- m.Serve() }()
+	defer m.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET /chats HTTP/1.1\r\nHost: astro\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n"))
+
+	// Accepted once the failures are over.
+	accepted, err := m.Upgrades().Accept()
+	if err != nil {
+		t.Fatalf("Expected the upgrade to be accepted, got: %v", err)
+	}
+	accepted.Close()
+
+	m.Close()
+	if err := <-served; !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected Serve to stop on a closed listener, got: %v", err)
+	}
+}
+
+func TestMuxHeadTimeout(t *testing.T) {
+	cases := []struct {
+		description string
+		head        string
+		counted     int64
+	}{
+		{
+			description: "upgrade",
+			head:        "GET /chats HTTP/1.1\r\nUpgrade: websocket\r\n",
+			counted:     1,
+		},
+		{
+			description: "plain request",
+			head:        "GET /index.html HTTP/1.1\r\nHost: astro\r\n",
+			counted:     0,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			m := startMux(t, 50*time.Millisecond, 0)
+			timedOut := metrics.TimedOutHandshakes.Value()
+
+			conn, err := net.Dial("tcp", m.listener.Addr().String())
+			if err != nil {
+				t.Fatalf("Failed to dial: %v", err)
+			}
+			defer conn.Close()
+
+			// The head is never finished.
+			conn.Write([]byte(c.head))
+
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			_, err = conn.Read(make([]byte, 1))
+			if err != io.EOF {
+				t.Errorf("Expected the stalled connection to be dropped, got: %v", err)
+			}
+
+			if counted := metrics.TimedOutHandshakes.Value() - timedOut; counted != c.counted {
+				t.Errorf("Expected [%d] timed out handshakes found [%d]", c.counted, counted)
+			}
+		})
+	}
+}
+
+func TestMuxMaxPending(t *testing.T) {
+	m := startMux(t, 0, 1)
+	shed := metrics.ShedHeads.Value()
+
+	stalled, err := net.Dial("tcp", m.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer stalled.Close()
+	stalled.Write([]byte("GET /chats HTTP/1.1\r\n"))
+
+	conn, err := net.Dial("tcp", m.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Errorf("Expected the connection over the cap to be dropped, got: %v", err)
+	}
+
+	if metrics.ShedHeads.Value()-shed != 1 {
+		t.Errorf("Expected the dropped connection to be counted")
+	}
+
+	// The slot is freed once the stalled head is done.
+	stalled.Write([]byte("Host: astro\r\n\r\n"))
+	stalled.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = stalled.Read(make([]byte, 1))
+	if err != nil {
+		t.Fatalf("Expected the plain handler's response, got: %v", err)
+	}
+
+	response, err := http.Get("http://" + m.listener.Addr().String() + "/index.html")
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	response.Body.Close()
+}
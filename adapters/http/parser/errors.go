@@ -0,0 +1,57 @@
+package http_parser
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	ErrMalformedRequest            = errors.New("Malformed request")
+	ErrRequestLineTooLong          = errors.New("Request line too long")
+	ErrHeadersTooLarge             = errors.New("Request headers too large")
+	ErrMethodNotAllowed            = errors.New("Method not allowed")
+	ErrHttpVersionNotSupported     = errors.New("HTTP version not supported")
+	ErrMissingHeader               = errors.New("Missing or invalid header")
+	ErrUnsupportedWebsocketVersion = errors.New("Unsupported websocket version")
+)
+
+// RequestError is a handshake request rejected while parsing, with the
+// HTTP status the server should answer it with.
+type RequestError struct {
+	Status int
+	// One of the sentinel errors above.
+	Err    error
+	Reason string
+}
+
+func newRequestError(status int, err error, reason string) *RequestError {
+	return &RequestError{
+		Status: status,
+		Err:    err,
+		Reason: reason,
+	}
+}
+
+func (e *RequestError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("%d %s: %v", e.Status, http.StatusText(e.Status), e.Err)
+	}
+
+	return fmt.Sprintf("%d %s: %v: %s", e.Status, http.StatusText(e.Status), e.Err, e.Reason)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// StatusFor returns the status a failed handshake should be answered
+// with, errors that aren't a *RequestError are bad requests.
+func StatusFor(err error) int {
+	var requestErr *RequestError
+	if errors.As(err, &requestErr) {
+		return requestErr.Status
+	}
+
+	return http.StatusBadRequest
+}
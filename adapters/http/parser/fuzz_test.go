@@ -0,0 +1,55 @@
+package http_parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzParseUpgradeRequest(f *testing.F) {
+	// Seeds taken from the table tests.
+	requestLines := []string{
+		"GET / HTTP/1.1",
+		"GET /chat HTTP/1.1",
+		"POST /chat HTTP/1.1",
+		"GET  HTTP/1.1",
+		"",
+	}
+	headers := [][]string{
+		{
+			"Host: astro",
+			"Upgrade: websocket",
+			"Sec-WebSocket-Key: kBQW2M+CkClJ1bvTT8O4LA==",
+			"Connection: Upgrade",
+			"Sec-WebSocket-Version: 13",
+		},
+		{
+			"Host: astro",
+			"Upgrade: websocket",
+			"Sec-WebSocket-Key: kBQW2M+CkClJ1bvTT8O4LA==",
+			"Connection: keep-alive, Upgrade",
+			"Sec-WebSocket-Version: 13",
+		},
+		{
+			"Host: astro",
+			"Upgrade: websocket",
+		},
+	}
+
+	for _, requestLine := range requestLines {
+		for _, lines := range headers {
+			request := requestLine + "\r\n" + strings.Join(lines, "\r\n") + "\r\n\r\n"
+			f.Add([]byte(request))
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, request []byte) {
+		handshake, err := ParseUpgradeRequest(request)
+		if err != nil {
+			return
+		}
+
+		if !strings.HasPrefix(handshake.RequestLine.Uri, "/") {
+			t.Errorf("Accepted request with URI [%s]", handshake.RequestLine.Uri)
+		}
+	})
+}
@@ -1,13 +1,15 @@
 package http_parser
 
 import (
-	"fmt"
+	"encoding/base64"
 	"net/http"
+	"net/textproto"
 	"strings"
 )
 
 type HandshakeRequestLine struct {
-	Uri string
+	Method string
+	Uri    string
 }
 
 type HandshakeHeaders struct {
@@ -31,136 +33,168 @@ type HandshakeHeaders struct {
 	// been base64-encoded (see Section 4 of [RFC4648]).  The nonce
 	// MUST be selected randomly for each connection.
 	SecWebSocketKey string
+	// https://datatracker.ietf.org/doc/html/rfc6455#section-9.1
+	// Optionally, a |Sec-WebSocket-Extensions| header field, with a
+	// list of values indicating which extensions the client would like
+	// to speak.
+	SecWebSocketExtensions string
+	// Optionally, a |Sec-WebSocket-Protocol| header field, with a list
+	// of values indicating which protocols the client would like to
+	// speak, ordered by preference.
+	SecWebSocketProtocol string
+	// https://datatracker.ietf.org/doc/html/rfc6455#section-4.1
+	// The request MUST include a header field with the name |Origin|
+	// if the request is coming from a browser client.
+	Origin string
 }
 
 type WebsocketHandshake struct {
 	RequestLine HandshakeRequestLine
 	Headers     HandshakeHeaders
+	// Every header of the request, keyed by canonical header name.
+	Fields http.Header
 }
 
-// https://datatracker.ietf.org/doc/html/rfc6455#section-4.1
-var requiredHeaders = map[string]string{
-	"Host":              "",
-	"Upgrade":           "websocket",
-	"Connection":        "Upgrade",
-	"Sec-WebSocket-Key": "",
-	// The request MUST include a header field with the name
-	// |Sec-WebSocket-Version|.  The value of this header field MUST be
-	// 13.
-	"Sec-WebSocket-Version": "13",
-}
+const websocketVersion = "13"
 
+// ParseUpgradeRequest parses a request received whole.
 func ParseUpgradeRequest(request []byte) (WebsocketHandshake, error) {
-	requestString := string(request)
+	parser := NewRequestParser(DefaultMaxRequestLineSize, DefaultMaxHeaderSize)
 
-	httpRequestParts := strings.Split(requestString, "\r\n")
-	if len(httpRequestParts) == 0 {
-		return WebsocketHandshake{}, fmt.Errorf("Invalid HTTP request: %s", requestString)
-	}
-
-	requestLine, err := parseHandshakeRequestLine(httpRequestParts[0])
+	_, isDone, err := parser.Feed(request)
 	if err != nil {
-		return WebsocketHandshake{}, fmt.Errorf("Invalid request line: %s", httpRequestParts[0])
+		return WebsocketHandshake{}, err
 	}
 
-	headerParts := httpRequestParts[1:]
-	headers, err := parseHandshakeHeaders(headerParts)
-	if err != nil {
-		return WebsocketHandshake{}, fmt.Errorf("Invalid headers: %s", err)
+	if !isDone {
+		return WebsocketHandshake{}, newRequestError(http.StatusBadRequest, ErrMalformedRequest, "incomplete request")
 	}
 
-	return WebsocketHandshake{
-		RequestLine: requestLine,
-		Headers:     headers,
-	}, nil
+	return parser.Handshake()
 }
 
 func parseHandshakeRequestLine(requestLine string) (HandshakeRequestLine, error) {
-	parts := strings.Split(strings.TrimSpace(requestLine), " ")
-	if len(parts) < 3 {
-		return HandshakeRequestLine{}, fmt.Errorf("Invalid Handshake Request-Line")
+	parts := strings.Fields(requestLine)
+	if len(parts) != 3 {
+		// The handshake has just 3 parts e.g. GET /chat HTTP/1.1
+		return HandshakeRequestLine{}, newRequestError(http.StatusBadRequest, ErrMalformedRequest, "invalid request line")
 	}
 
-	parts = parts[:3] // The handshake has just 3 parts e.g. GET /chat HTTP/1.1
-	if parts[0] != "GET" {
-		return HandshakeRequestLine{}, fmt.Errorf("Invalid method")
+	// The method of the request MUST be GET
+	if parts[0] != http.MethodGet {
+		return HandshakeRequestLine{}, newRequestError(http.StatusMethodNotAllowed, ErrMethodNotAllowed, parts[0])
 	}
 
-	if parts[1][0] != '/' {
-		return HandshakeRequestLine{}, fmt.Errorf("Invalid URI")
+	if !strings.HasPrefix(parts[1], "/") {
+		return HandshakeRequestLine{}, newRequestError(http.StatusBadRequest, ErrMalformedRequest, "invalid URI")
 	}
 
 	major, minor, ok := http.ParseHTTPVersion(parts[2])
 	if !ok {
-		return HandshakeRequestLine{}, fmt.Errorf("Invalid Protocol version")
+		return HandshakeRequestLine{}, newRequestError(http.StatusBadRequest, ErrMalformedRequest, "invalid protocol version")
 	}
 
+	// The HTTP version MUST be at least 1.1.
 	acceptedVersion := (major == 1 && minor == 1) || (major > 1)
 	if !acceptedVersion {
-		return HandshakeRequestLine{}, fmt.Errorf("Invalid Protocol version")
+		return HandshakeRequestLine{}, newRequestError(http.StatusHTTPVersionNotSupported, ErrHttpVersionNotSupported, parts[2])
 	}
 
-	return HandshakeRequestLine{Uri: parts[1]}, nil
+	return HandshakeRequestLine{Method: parts[0], Uri: parts[1]}, nil
 }
 
-func parseHandshakeHeaders(headerLines []string) (HandshakeHeaders, error) {
-	headers := parseHttpHeaders(headerLines)
-	if !hasRequiredHanshakeHeaders(headers) {
-		return HandshakeHeaders{}, fmt.Errorf("Invalid headers")
+// parseHeaderLine splits a header line into its canonical name and value.
+// https://datatracker.ietf.org/doc/html/rfc7230#section-3.2
+//
+//	header-field   = field-name ":" OWS field-value OWS
+func parseHeaderLine(line string) (string, string, error) {
+	// Obsolete line folding isn't supported.
+	if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+		return "", "", newRequestError(http.StatusBadRequest, ErrMalformedRequest, "folded header line")
+	}
+
+	name, value, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return "", "", newRequestError(http.StatusBadRequest, ErrMalformedRequest, "invalid header line")
+	}
+
+	// No whitespace is allowed between the header field-name and colon.
+	if strings.ContainsAny(name, " \t") {
+		return "", "", newRequestError(http.StatusBadRequest, ErrMalformedRequest, "invalid header name")
+	}
+
+	return textproto.CanonicalMIMEHeaderKey(name), strings.Trim(value, " \t"), nil
+}
+
+func makeHandshakeHeaders(headers http.Header) (HandshakeHeaders, error) {
+	err := validateHandshakeHeaders(headers)
+	if err != nil {
+		return HandshakeHeaders{}, err
 	}
 
 	return HandshakeHeaders{
-		Host:            headers["Host"],
-		Upgrade:         headers["Upgrade"],
-		Connection:      headers["Connection"],
-		SecWebSocketKey: headers["Sec-WebSocket-Key"],
+		Host:            headers.Get("Host"),
+		Upgrade:         headers.Get("Upgrade"),
+		Connection:      strings.Join(headers.Values("Connection"), ", "),
+		SecWebSocketKey: headers.Get("Sec-WebSocket-Key"),
+
+		// Repeated list headers are equivalent to a single
+		// comma separated header.
+		SecWebSocketExtensions: strings.Join(headers.Values("Sec-WebSocket-Extensions"), ", "),
+		SecWebSocketProtocol:   strings.Join(headers.Values("Sec-WebSocket-Protocol"), ", "),
+		Origin:                 headers.Get("Origin"),
 	}, nil
-
 }
 
-func hasRequiredHanshakeHeaders(headers map[string]string) bool {
-	for k, v := range requiredHeaders {
-		value, ok := headers[k]
+// https://datatracker.ietf.org/doc/html/rfc6455#section-4.1
+func validateHandshakeHeaders(headers http.Header) error {
+	if len(headers.Values("Host")) != 1 || headers.Get("Host") == "" {
+		return newRequestError(http.StatusBadRequest, ErrMissingHeader, "Host")
+	}
 
-		if !ok {
-			return false
-		}
+	if !hasToken(headers.Values("Upgrade"), "websocket") {
+		return newRequestError(http.StatusBadRequest, ErrMissingHeader, "Upgrade")
+	}
 
-		if v == "" {
-			// Header value isn't required for validation
-			continue
-		}
+	if !hasToken(headers.Values("Connection"), "upgrade") {
+		return newRequestError(http.StatusBadRequest, ErrMissingHeader, "Connection")
+	}
 
-		if k == "Connection" && strings.Contains(value, v) {
-			continue
-		}
+	keys := headers.Values("Sec-WebSocket-Key")
+	if len(keys) != 1 || !isValidWebsocketKey(keys[0]) {
+		return newRequestError(http.StatusBadRequest, ErrMissingHeader, "Sec-WebSocket-Key")
+	}
 
-		if v != value {
-			return false
-		}
+	// The request MUST include a header field with the name
+	// |Sec-WebSocket-Version|.  The value of this header field MUST be
+	// 13.
+	versions := headers.Values("Sec-WebSocket-Version")
+	if len(versions) == 0 {
+		return newRequestError(http.StatusBadRequest, ErrMissingHeader, "Sec-WebSocket-Version")
 	}
 
-	return true
-}
+	if len(versions) != 1 || versions[0] != websocketVersion {
+		return newRequestError(http.StatusUpgradeRequired, ErrUnsupportedWebsocketVersion, strings.Join(versions, ", "))
+	}
 
-func parseHttpHeaders(headerLines []string) map[string]string {
-	headers := make(map[string]string)
-	for _, line := range headerLines {
-		if strings.TrimSpace(line) == "" {
-			// Body separator
-			break
-		}
-		splits := strings.Split(line, ": ")
+	return nil
+}
 
-		if len(splits) != 2 {
-			// Skip invalid headers
-			continue
+// hasToken looks for a token in a comma separated
+// header value, ignoring the case.
+func hasToken(values []string, token string) bool {
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
 		}
-
-		key := splits[0]
-		value := splits[1]
-		headers[key] = value
 	}
 
-	return headers
+	return false
+}
+
+func isValidWebsocketKey(key string) bool {
+	nonce, err := base64.StdEncoding.DecodeString(key)
+	return err == nil && len(nonce) == 16
 }
@@ -1,6 +1,10 @@
 package http_parser
 
-import "testing"
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
 
 func TestParseRequestLine(t *testing.T) {
 	cases := []struct {
@@ -24,6 +28,11 @@ func TestParseRequestLine(t *testing.T) {
 			input:       "POST /chat HTTP/1.1\r\n",
 			fails:       true,
 		},
+		{
+			description: "Invalid empty URI",
+			input:       "GET  HTTP/1.1\r\n",
+			fails:       true,
+		},
 	}
 
 	for _, c := range cases {
@@ -118,7 +127,12 @@ func TestParseHasValidHandshakeHeaders(t *testing.T) {
 
 	for _, c := range cases {
 		t.Run(c.description, func(t *testing.T) {
-			actual := hasRequiredHanshakeHeaders(c.input)
+			headers := http.Header{}
+			for name, value := range c.input {
+				headers.Add(name, value)
+			}
+
+			actual := validateHandshakeHeaders(headers) == nil
 			if actual != c.valid {
 				t.Errorf("Expected valid: %t, got: %t", c.valid, actual)
 			}
@@ -162,6 +176,24 @@ func TestParseHandshakeHeaders(t *testing.T) {
 				Connection:      "keep-alive, Upgrade",
 			},
 		},
+		{
+			input: []string{
+				"Host: astro",
+				"Upgrade: websocket",
+				"Sec-WebSocket-Key: kBQW2M+CkClJ1bvTT8O4LA==",
+				"Connection: Upgrade",
+				"Sec-WebSocket-Version: 13",
+				"Sec-WebSocket-Extensions: permessage-deflate; server_max_window_bits=10",
+				"Sec-WebSocket-Extensions: permessage-deflate",
+			},
+			output: HandshakeHeaders{
+				Host:                   "astro",
+				Upgrade:                "websocket",
+				SecWebSocketKey:        "kBQW2M+CkClJ1bvTT8O4LA==",
+				Connection:             "Upgrade",
+				SecWebSocketExtensions: "permessage-deflate; server_max_window_bits=10, permessage-deflate",
+			},
+		},
 		{
 			input: []string{
 				"Host: astro",
@@ -172,7 +204,9 @@ func TestParseHandshakeHeaders(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		actual, err := parseHandshakeHeaders(c.input)
+		request := "GET /chat HTTP/1.1\r\n" + strings.Join(c.input, "\r\n") + "\r\n\r\n"
+		handshake, err := ParseUpgradeRequest([]byte(request))
+		actual := handshake.Headers
 		if c.fails {
 			if err == nil {
 				t.Errorf("Expected error for input: %s", c.input)
@@ -198,6 +232,10 @@ func TestParseHandshakeHeaders(t *testing.T) {
 			if actual.Connection != c.output.Connection {
 				t.Errorf("Expected Connection: %s, got: %s", c.output.Connection, actual.Connection)
 			}
+
+			if actual.SecWebSocketExtensions != c.output.SecWebSocketExtensions {
+				t.Errorf("Expected Sec-WebSocket-Extensions: %s, got: %s", c.output.SecWebSocketExtensions, actual.SecWebSocketExtensions)
+			}
 		}
 	}
 }
@@ -0,0 +1,163 @@
+package http_parser
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+const (
+	DefaultMaxRequestLineSize = 8 << 10
+	DefaultMaxHeaderSize      = 16 << 10
+)
+
+type requestParserState uint8
+
+const (
+	parsingRequestLine requestParserState = iota
+	parsingHeaders
+	parsingDone
+)
+
+// RequestParser parses an upgrade request fed to it in chunks as they're
+// read off the connection, until the empty line ending the headers.
+type RequestParser struct {
+	maxRequestLineSize int
+	maxHeaderSize      int
+
+	state requestParserState
+	line  []byte
+	// Blank lines skipped ahead of the request line, in bytes.
+	skippedSize int
+	headerSize  int
+	requestLine HandshakeRequestLine
+	headers     http.Header
+	err         error
+}
+
+func NewRequestParser(maxRequestLineSize int, maxHeaderSize int) *RequestParser {
+	return &RequestParser{
+		maxRequestLineSize: maxRequestLineSize,
+		maxHeaderSize:      maxHeaderSize,
+		state:              parsingRequestLine,
+		headers:            http.Header{},
+	}
+}
+
+// Feed parses the next chunk of the request. It returns how many bytes of
+// the chunk belong to the request, bytes past the end of the request
+// (e.g. a frame sent right after the handshake) aren't consumed.
+func (p *RequestParser) Feed(data []byte) (int, bool, error) {
+	if p.err != nil {
+		return 0, false, p.err
+	}
+
+	consumed := 0
+	for consumed < len(data) && p.state != parsingDone {
+		rest := data[consumed:]
+		end := bytes.IndexByte(rest, '\n')
+		if end == -1 {
+			p.line = append(p.line, rest...)
+			consumed = len(data)
+			p.err = p.checkLineSize()
+			break
+		}
+
+		p.line = append(p.line, rest[:end]...)
+		consumed += end + 1
+
+		p.err = p.checkLineSize()
+		if p.err != nil {
+			break
+		}
+
+		line := strings.TrimSuffix(string(p.line), "\r")
+		if p.state == parsingRequestLine && line == "" {
+			p.skippedSize += len(p.line) + 1
+		}
+		p.line = p.line[:0]
+		p.err = p.parseLine(line)
+		if p.err != nil {
+			break
+		}
+	}
+
+	if p.err != nil {
+		return consumed, false, p.err
+	}
+
+	return consumed, p.state == parsingDone, nil
+}
+
+// Handshake validates the parsed request, once Feed is done.
+func (p *RequestParser) Handshake() (WebsocketHandshake, error) {
+	if p.err != nil {
+		return WebsocketHandshake{}, p.err
+	}
+
+	if p.state != parsingDone {
+		return WebsocketHandshake{}, newRequestError(http.StatusBadRequest, ErrMalformedRequest, "incomplete request")
+	}
+
+	headers, err := makeHandshakeHeaders(p.headers)
+	if err != nil {
+		return WebsocketHandshake{}, err
+	}
+
+	return WebsocketHandshake{
+		RequestLine: p.requestLine,
+		Headers:     headers,
+		Fields:      p.headers,
+	}, nil
+}
+
+func (p *RequestParser) parseLine(line string) error {
+	switch p.state {
+	case parsingRequestLine:
+		// https://datatracker.ietf.org/doc/html/rfc7230#section-3.5
+		// A server that is expecting to receive and parse a request-line
+		// SHOULD ignore at least one empty line (CRLF) received prior to
+		// the request-line.
+		if line == "" {
+			return nil
+		}
+
+		requestLine, err := parseHandshakeRequestLine(line)
+		if err != nil {
+			return err
+		}
+
+		p.requestLine = requestLine
+		p.state = parsingHeaders
+	case parsingHeaders:
+		if line == "" {
+			p.state = parsingDone
+			return nil
+		}
+
+		p.headerSize += len(line)
+		name, value, err := parseHeaderLine(line)
+		if err != nil {
+			return err
+		}
+
+		p.headers.Add(name, value)
+	}
+
+	return nil
+}
+
+// checkLineSize bounds the bytes buffered for the current line.
+func (p *RequestParser) checkLineSize() error {
+	// Blank lines ahead of the request line count toward its size, so
+	// a client can't send them forever.
+	if p.state == parsingRequestLine && p.skippedSize+len(p.line) > p.maxRequestLineSize {
+		return newRequestError(http.StatusRequestURITooLong, ErrRequestLineTooLong, "")
+	}
+
+	if p.state == parsingHeaders && p.headerSize+len(p.line) > p.maxHeaderSize {
+		return newRequestError(http.StatusRequestHeaderFieldsTooLarge, ErrHeadersTooLarge, "")
+	}
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package http_parser
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const upgradeRequest = "GET /chats?room=1 HTTP/1.1\r\n" +
+	"host: astro\r\n" +
+	"upgrade: WebSocket\r\n" +
+	"connection: keep-alive, upgrade\r\n" +
+	"sec-websocket-key: kBQW2M+CkClJ1bvTT8O4LA==\r\n" +
+	"sec-websocket-version:13\r\n" +
+	"Sec-WebSocket-Extensions: permessage-deflate\r\n" +
+	"SEC-WEBSOCKET-EXTENSIONS:  x-webkit-deflate-frame \r\n" +
+	"\r\n"
+
+func TestRequestParserFeed(t *testing.T) {
+	trailing := "\x81\x05hello"
+	cases := []struct {
+		description string
+		chunkSize   int
+		// Blank lines ahead of the request line.
+		leading string
+	}{
+		{description: "Whole request", chunkSize: len(upgradeRequest) + len(trailing)},
+		{description: "Byte by byte", chunkSize: 1},
+		{description: "Split chunks", chunkSize: 7},
+		{description: "Blank lines ahead", chunkSize: 7, leading: "\r\n\n"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			input := []byte(c.leading + upgradeRequest + trailing)
+			parser := NewRequestParser(DefaultMaxRequestLineSize, DefaultMaxHeaderSize)
+
+			total := 0
+			isDone := false
+			for total < len(input) && !isDone {
+				end := min(total+c.chunkSize, len(input))
+				consumed, done, err := parser.Feed(input[total:end])
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				total += consumed
+				isDone = done
+			}
+
+			if !isDone {
+				t.Fatalf("Expected the request to be done")
+			}
+
+			if expected := len(c.leading) + len(upgradeRequest); total != expected {
+				t.Errorf("Expected %d bytes consumed, got: %d", expected, total)
+			}
+
+			handshake, err := parser.Handshake()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if handshake.RequestLine.Uri != "/chats?room=1" {
+				t.Errorf("Expected URI: /chats?room=1, got: %s", handshake.RequestLine.Uri)
+			}
+
+			if handshake.Headers.SecWebSocketKey != "kBQW2M+CkClJ1bvTT8O4LA==" {
+				t.Errorf("Unexpected key: %s", handshake.Headers.SecWebSocketKey)
+			}
+
+			expectedExtensions := "permessage-deflate, x-webkit-deflate-frame"
+			if handshake.Headers.SecWebSocketExtensions != expectedExtensions {
+				t.Errorf("Expected extensions: %s, got: %s", expectedExtensions, handshake.Headers.SecWebSocketExtensions)
+			}
+
+			if handshake.Fields.Get("Sec-WebSocket-Version") != "13" {
+				t.Errorf("Expected version header to be canonicalized, got: %v", handshake.Fields)
+			}
+		})
+	}
+}
+
+func TestRequestParserErrors(t *testing.T) {
+	validHeaders := "Host: astro\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: kBQW2M+CkClJ1bvTT8O4LA==\r\n"
+
+	cases := []struct {
+		description string
+		input       string
+		status      int
+		err         error
+	}{
+		{
+			description: "Wrong method",
+			input:       "POST /chat HTTP/1.1\r\n" + validHeaders + "\r\n",
+			status:      http.StatusMethodNotAllowed,
+			err:         ErrMethodNotAllowed,
+		},
+		{
+			description: "Old HTTP version",
+			input:       "GET /chat HTTP/1.0\r\n" + validHeaders + "\r\n",
+			status:      http.StatusHTTPVersionNotSupported,
+			err:         ErrHttpVersionNotSupported,
+		},
+		{
+			description: "Wrong websocket version",
+			input:       "GET /chat HTTP/1.1\r\n" + validHeaders + "Sec-WebSocket-Version: 8\r\n\r\n",
+			status:      http.StatusUpgradeRequired,
+			err:         ErrUnsupportedWebsocketVersion,
+		},
+		{
+			description: "Missing websocket version",
+			input:       "GET /chat HTTP/1.1\r\n" + validHeaders + "\r\n",
+			status:      http.StatusBadRequest,
+			err:         ErrMissingHeader,
+		},
+		{
+			description: "Duplicate websocket key",
+			input: "GET /chat HTTP/1.1\r\n" + validHeaders +
+				"Sec-WebSocket-Key: kBQW2M+CkClJ1bvTT8O4LA==\r\nSec-WebSocket-Version: 13\r\n\r\n",
+			status: http.StatusBadRequest,
+			err:    ErrMissingHeader,
+		},
+		{
+			description: "Short websocket key",
+			input: "GET /chat HTTP/1.1\r\nHost: astro\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+				"Sec-WebSocket-Key: a2V5\r\nSec-WebSocket-Version: 13\r\n\r\n",
+			status: http.StatusBadRequest,
+			err:    ErrMissingHeader,
+		},
+		{
+			description: "Whitespace before colon",
+			input:       "GET /chat HTTP/1.1\r\nHost : astro\r\n\r\n",
+			status:      http.StatusBadRequest,
+			err:         ErrMalformedRequest,
+		},
+		{
+			description: "Folded header",
+			input:       "GET /chat HTTP/1.1\r\nHost: astro\r\n  folded\r\n\r\n",
+			status:      http.StatusBadRequest,
+			err:         ErrMalformedRequest,
+		},
+		{
+			description: "Request line too long",
+			input:       "GET /" + strings.Repeat("a", DefaultMaxRequestLineSize) + " HTTP/1.1\r\n",
+			status:      http.StatusRequestURITooLong,
+			err:         ErrRequestLineTooLong,
+		},
+		{
+			description: "Request line too long without a line end",
+			input:       "GET /" + strings.Repeat("a", DefaultMaxRequestLineSize),
+			status:      http.StatusRequestURITooLong,
+			err:         ErrRequestLineTooLong,
+		},
+		{
+			description: "Blank lines without end",
+			input:       strings.Repeat("\r\n", DefaultMaxRequestLineSize),
+			status:      http.StatusRequestURITooLong,
+			err:         ErrRequestLineTooLong,
+		},
+		{
+			description: "Headers too large",
+			input:       "GET /chat HTTP/1.1\r\n" + strings.Repeat("X-Padding: aaaaaaaaaaaaaaaa\r\n", DefaultMaxHeaderSize/16),
+			status:      http.StatusRequestHeaderFieldsTooLarge,
+			err:         ErrHeadersTooLarge,
+		},
+		{
+			description: "Incomplete request",
+			input:       "GET /chat HTTP/1.1\r\n" + validHeaders,
+			status:      http.StatusBadRequest,
+			err:         ErrMalformedRequest,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			_, err := ParseUpgradeRequest([]byte(c.input))
+			if err == nil {
+				t.Fatalf("Expected error for input: %q", c.input)
+			}
+
+			if !errors.Is(err, c.err) {
+				t.Errorf("Expected error: %v, got: %v", c.err, err)
+			}
+
+			if StatusFor(err) != c.status {
+				t.Errorf("Expected status: %d, got: %d", c.status, StatusFor(err))
+			}
+		})
+	}
+}
+
+func TestRequestParserIgnoresLeadingEmptyLines(t *testing.T) {
+	handshake, err := ParseUpgradeRequest([]byte("\r\n" + upgradeRequest))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if handshake.RequestLine.Method != http.MethodGet {
+		t.Errorf("Expected method GET, got: %s", handshake.RequestLine.Method)
+	}
+}
@@ -0,0 +1,130 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var ErrNotFound = errors.New("Not found")
+
+// Request is the part of the handshake URI a handler needs.
+type Request struct {
+	Path string
+	// Values of the {name} segments of the matched pattern.
+	Params map[string]string
+	Query  url.Values
+}
+
+type route[THandler any] struct {
+	pattern  string
+	segments []string
+	handler  THandler
+}
+
+// Router picks the handler of a socket by its handshake URI. Patterns are
+// matched segment by segment, a {name} segment matches any non-empty
+// segment and is passed to the handler as a parameter, e.g. /chats/{roomId}.
+// Routes are tried in the order they were registered.
+type Router[THandler any] struct {
+	routes []route[THandler]
+}
+
+func New[THandler any]() *Router[THandler] {
+	return &Router[THandler]{}
+}
+
+// Handle registers a handler for a pattern, it panics on malformed
+// patterns since they're a programming error.
+func (r *Router[THandler]) Handle(pattern string, handler THandler) {
+	if !strings.HasPrefix(pattern, "/") {
+		panic(fmt.Sprintf("router: pattern %q must start with /", pattern))
+	}
+
+	segments := strings.Split(pattern, "/")[1:]
+	names := map[string]bool{}
+	for _, segment := range segments {
+		name, isParam := paramName(segment)
+		if !isParam {
+			continue
+		}
+
+		if name == "" || names[name] {
+			panic(fmt.Sprintf("router: invalid parameter %q in pattern %q", segment, pattern))
+		}
+		names[name] = true
+	}
+
+	r.routes = append(r.routes, route[THandler]{
+		pattern:  pattern,
+		segments: segments,
+		handler:  handler,
+	})
+}
+
+// Match finds the handler of a request URI, e.g. /chats/42?user=a.
+func (r *Router[THandler]) Match(uri string) (THandler, Request, error) {
+	var handler THandler
+
+	// Errors only name the path, the query may carry a token
+	// that mustn't end up in logs or responses.
+	requestUrl, err := url.ParseRequestURI(uri)
+	if err != nil {
+		path, _, _ := strings.Cut(uri, "?")
+		return handler, Request{}, fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
+
+	segments := strings.Split(requestUrl.EscapedPath(), "/")[1:]
+	for _, route := range r.routes {
+		params, isMatch := route.match(segments)
+		if !isMatch {
+			continue
+		}
+
+		return route.handler, Request{
+			Path:   requestUrl.Path,
+			Params: params,
+			Query:  requestUrl.Query(),
+		}, nil
+	}
+
+	return handler, Request{}, fmt.Errorf("%w: %s", ErrNotFound, requestUrl.Path)
+}
+
+func (r route[THandler]) match(segments []string) (map[string]string, bool) {
+	if len(segments) != len(r.segments) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for i, segment := range r.segments {
+		value, err := url.PathUnescape(segments[i])
+		if err != nil {
+			return nil, false
+		}
+
+		name, isParam := paramName(segment)
+		if !isParam {
+			if value != segment {
+				return nil, false
+			}
+			continue
+		}
+
+		if value == "" {
+			return nil, false
+		}
+		params[name] = value
+	}
+
+	return params, true
+}
+
+func paramName(segment string) (string, bool) {
+	if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+		return "", false
+	}
+
+	return segment[1 : len(segment)-1], true
+}
@@ -0,0 +1,145 @@
+package router
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRouterMatch(t *testing.T) {
+	r := New[string]()
+	r.Handle("/chats", "lobby")
+	r.Handle("/chats/new", "new")
+	r.Handle("/chats/{roomId}", "room")
+	r.Handle("/chats/{roomId}/users/{userId}", "user")
+	r.Handle("/admin/tap", "tap")
+
+	cases := []struct {
+		description string
+		uri         string
+		handler     string
+		params      map[string]string
+		query       map[string]string
+		notFound    bool
+	}{
+		{
+			description: "Literal path",
+			uri:         "/chats",
+			handler:     "lobby",
+		},
+		{
+			description: "Earlier route wins",
+			uri:         "/chats/new",
+			handler:     "new",
+		},
+		{
+			description: "Path parameter",
+			uri:         "/chats/42",
+			handler:     "room",
+			params:      map[string]string{"roomId": "42"},
+		},
+		{
+			description: "Escaped path parameter",
+			uri:         "/chats/a%2Fb",
+			handler:     "room",
+			params:      map[string]string{"roomId": "a/b"},
+		},
+		{
+			description: "Several parameters and a query",
+			uri:         "/chats/42/users/7?token=abc&x=1",
+			handler:     "user",
+			params:      map[string]string{"roomId": "42", "userId": "7"},
+			query:       map[string]string{"token": "abc", "x": "1"},
+		},
+		{
+			description: "Query on a literal path",
+			uri:         "/admin/tap?room=42",
+			handler:     "tap",
+			query:       map[string]string{"room": "42"},
+		},
+		{
+			description: "Empty parameter",
+			uri:         "/chats/",
+			notFound:    true,
+		},
+		{
+			description: "Unknown path",
+			uri:         "/admin",
+			notFound:    true,
+		},
+		{
+			description: "Longer path",
+			uri:         "/admin/tap/x",
+			notFound:    true,
+		},
+		{
+			description: "Invalid URI",
+			uri:         "chats",
+			notFound:    true,
+		},
+		{
+			description: "Unknown path with a token",
+			uri:         "/admin?token=secret",
+			notFound:    true,
+		},
+		{
+			description: "Invalid URI with a token",
+			uri:         "chats?token=secret",
+			notFound:    true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			handler, request, err := r.Match(c.uri)
+			if c.notFound {
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("Expected not found for %s, got: %v", c.uri, err)
+				}
+
+				if strings.Contains(err.Error(), "secret") {
+					t.Errorf("Expected the error not to show the query, got: %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error for %s: %v", c.uri, err)
+			}
+
+			if handler != c.handler {
+				t.Errorf("Expected handler: %s, got: %s", c.handler, handler)
+			}
+
+			if len(request.Params) != len(c.params) {
+				t.Errorf("Expected params: %v, got: %v", c.params, request.Params)
+			}
+			for name, value := range c.params {
+				if request.Params[name] != value {
+					t.Errorf("Expected param %s: %s, got: %s", name, value, request.Params[name])
+				}
+			}
+
+			for name, value := range c.query {
+				if request.Query.Get(name) != value {
+					t.Errorf("Expected query %s: %s, got: %s", name, value, request.Query.Get(name))
+				}
+			}
+		})
+	}
+}
+
+func TestRouterHandlePanicsOnInvalidPattern(t *testing.T) {
+	patterns := []string{"chats", "/chats/{}", "/chats/{id}/{id}"}
+	for _, pattern := range patterns {
+		t.Run(pattern, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected pattern %s to panic", pattern)
+				}
+			}()
+
+			New[string]().Handle(pattern, "")
+		})
+	}
+}
@@ -0,0 +1,37 @@
+// Package metrics publishes server counters as JSON. They're kept out
+// of expvar's global registry, which also serves the command line, and
+// any secret passed on it.
+package metrics
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+)
+
+var counters = new(expvar.Map).Init()
+
+var (
+	// Handshakes in progress.
+	PendingHandshakes = newCounter("handshakes_pending")
+	// Handshakes the client didn't finish in time, e.g. slowloris.
+	TimedOutHandshakes = newCounter("handshakes_timed_out")
+	// Connections refused because too many handshakes were pending.
+	ShedHandshakes = newCounter("handshakes_shed")
+	// Connections dropped because too many request heads were being read.
+	ShedHeads = newCounter("heads_shed")
+)
+
+func newCounter(name string) *expvar.Int {
+	counter := new(expvar.Int)
+	counters.Set(name, counter)
+	return counter
+}
+
+// Handler serves the counters, and only them, as a JSON object.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprintln(w, counters.String())
+	})
+}
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	PendingHandshakes.Add(2)
+	defer PendingHandshakes.Add(-2)
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+
+	served := map[string]any{}
+	err := json.Unmarshal(recorder.Body.Bytes(), &served)
+	if err != nil {
+		t.Fatalf("Failed to decode [%s]: %v", recorder.Body, err)
+	}
+
+	if served["handshakes_pending"] != float64(2) {
+		t.Errorf("Expected [2] pending handshakes found [%v]", served["handshakes_pending"])
+	}
+
+	for _, name := range []string{"cmdline", "memstats"} {
+		if _, ok := served[name]; ok {
+			t.Errorf("Expected [%s] not to be served", name)
+		}
+	}
+}
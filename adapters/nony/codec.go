@@ -0,0 +1,53 @@
+package nony
+
+import (
+	"encoding/json"
+
+	"github.com/shakram02/nony-chat/adapters/websockets"
+)
+
+// Wire formats, negotiated as websocket subprotocols.
+const ProtocolJsonV1 = "nony.v1.json"
+
+// Codec encodes packets in one wire format, each connection
+// picks its codec by the negotiated subprotocol.
+type Codec interface {
+	Decode(data []byte) (*Packet, error)
+	Encode(packet *Packet) ([]byte, error)
+	// The websocket message type carrying encoded packets.
+	OpCode() websockets.FrameOpCode
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Decode(data []byte) (*Packet, error) {
+	return parse(data)
+}
+
+func (jsonCodec) Encode(packet *Packet) ([]byte, error) {
+	return json.Marshal(packet)
+}
+
+func (jsonCodec) OpCode() websockets.FrameOpCode {
+	return websockets.OpTextFrame
+}
+
+var codecs = map[string]Codec{
+	ProtocolJsonV1: jsonCodec{},
+}
+
+// Protocols lists the supported subprotocols.
+func Protocols() []string {
+	return []string{ProtocolJsonV1}
+}
+
+// CodecFor returns the codec of a negotiated subprotocol, clients
+// that didn't negotiate one speak JSON.
+func CodecFor(protocol string) Codec {
+	codec, ok := codecs[protocol]
+	if !ok {
+		return jsonCodec{}
+	}
+
+	return codec
+}
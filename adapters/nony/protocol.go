@@ -26,8 +26,8 @@ type Packet struct {
 	Timestamp time.Time      `json:"timestamp"`
 }
 
-func New(websocketFrame *websockets.Frame) *Packet {
-	data := websocketFrame.Data
+func New(websocketMessage *websockets.Message) *Packet {
+	data := websocketMessage.Data
 
 	packet, err := parse(data)
 	if err != nil {
@@ -1,7 +1,11 @@
 package adapter
 
+// Adapter converts between the units of two neighbouring layers, e.g.
+// bytes and websocket frames.
 type Adapter[THigher any, TLower any] interface {
-	CanReceive() bool
-	Receive([]TLower) THigher
-	Send(THigher) []TLower
+	// Receive buffers a unit read from the lower layer and returns the
+	// higher units it completed, none while one is still partial.
+	Receive(TLower) ([]THigher, error)
+	// Send decomposes a higher unit into the lower units carrying it.
+	Send(THigher) ([]TLower, error)
 }
@@ -0,0 +1,83 @@
+package adapter
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/shakram02/nony-chat/adapters/nony"
+)
+
+var ErrLineTooLong = errors.New("Line too long")
+
+// Lines cuts the byte stream into newline terminated lines, as typed
+// in a terminal. A carriage return ending a line is dropped, blank
+// lines are skipped.
+type Lines struct {
+	maxLineLength int
+	partial       []byte
+}
+
+func NewLines(maxLineLength int) *Lines {
+	return &Lines{
+		maxLineLength: maxLineLength,
+	}
+}
+
+func (l *Lines) Receive(chunk []byte) ([][]byte, error) {
+	l.partial = append(l.partial, chunk...)
+
+	lines := [][]byte{}
+	for {
+		end := bytes.IndexByte(l.partial, '\n')
+		if end < 0 {
+			break
+		}
+
+		line := bytes.TrimSuffix(l.partial[:end], []byte{'\r'})
+		l.partial = l.partial[end+1:]
+		if len(line) > l.maxLineLength {
+			return lines, ErrLineTooLong
+		}
+
+		if len(bytes.TrimSpace(line)) != 0 {
+			lines = append(lines, line)
+		}
+	}
+
+	if len(l.partial) > l.maxLineLength {
+		return lines, ErrLineTooLong
+	}
+
+	return lines, nil
+}
+
+func (l *Lines) Send(line []byte) ([][]byte, error) {
+	return [][]byte{append(bytes.Clone(line), '\n')}, nil
+}
+
+// LinePackets decodes lines into packets, one packet a line.
+type LinePackets struct {
+	codec nony.Codec
+}
+
+func NewLinePackets(codec nony.Codec) *LinePackets {
+	return &LinePackets{
+		codec: codec,
+	}
+}
+
+// Receive passes undecodable lines up as nil packets, like Nony does
+// with messages.
+func (p *LinePackets) Receive(line []byte) ([]*nony.Packet, error) {
+	packet, _ := p.codec.Decode(line)
+	return []*nony.Packet{packet}, nil
+}
+
+func (p *LinePackets) Send(packet *nony.Packet) ([][]byte, error) {
+	data, err := p.codec.Encode(packet)
+	if err != nil {
+		return nil, err
+	}
+
+	return [][]byte{data}, nil
+}
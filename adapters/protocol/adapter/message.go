@@ -0,0 +1,55 @@
+package adapter
+
+import (
+	"fmt"
+
+	"github.com/shakram02/nony-chat/adapters/websockets"
+)
+
+// Message joins frames into messages, control messages included, and
+// sends each message in a single frame.
+type Message struct {
+	assembler *websockets.MessageAssembler
+	deflate   *websockets.Deflate
+}
+
+func NewMessage(maxMessageSize uint64) *Message {
+	return &Message{
+		assembler: websockets.NewMessageAssembler(maxMessageSize),
+	}
+}
+
+// EnableCompression compresses and decompresses data messages
+// once permessage-deflate is negotiated in the handshake.
+func (m *Message) EnableCompression(params websockets.DeflateParams) {
+	m.deflate = websockets.NewServerDeflate(params)
+	m.assembler.EnableCompression(m.deflate)
+}
+
+// Deflate is the compression context shared by the messages,
+// nil unless compression is enabled.
+func (m *Message) Deflate() *websockets.Deflate {
+	return m.deflate
+}
+
+func (m *Message) Receive(frame *websockets.Frame) ([]*websockets.Message, error) {
+	message, err := m.assembler.Push(frame)
+	if err != nil || message == nil {
+		return nil, err
+	}
+
+	return []*websockets.Message{message}, nil
+}
+
+func (m *Message) Send(message *websockets.Message) ([]*websockets.Frame, error) {
+	frame := websockets.NewFrame(message.OpCode, message.Data)
+	if m.deflate != nil && !frame.IsControl() {
+		compressed, err := m.deflate.CompressFrame(frame)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress message: %w", err)
+		}
+		frame = compressed
+	}
+
+	return []*websockets.Frame{frame}, nil
+}
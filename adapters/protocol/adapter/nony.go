@@ -0,0 +1,34 @@
+package adapter
+
+import (
+	"github.com/shakram02/nony-chat/adapters/nony"
+	"github.com/shakram02/nony-chat/adapters/websockets"
+)
+
+// Nony decodes data messages into packets with the codec of the
+// negotiated subprotocol.
+type Nony struct {
+	codec nony.Codec
+}
+
+func NewNony(codec nony.Codec) *Nony {
+	return &Nony{
+		codec: codec,
+	}
+}
+
+// Receive passes undecodable messages up as nil packets, it's up to
+// the reader to drop them or the connection.
+func (n *Nony) Receive(message *websockets.Message) ([]*nony.Packet, error) {
+	packet, _ := n.codec.Decode(message.Data)
+	return []*nony.Packet{packet}, nil
+}
+
+func (n *Nony) Send(packet *nony.Packet) ([]*websockets.Message, error) {
+	data, err := n.codec.Encode(packet)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*websockets.Message{{OpCode: n.codec.OpCode(), Data: data}}, nil
+}
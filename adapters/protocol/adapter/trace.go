@@ -0,0 +1,25 @@
+package adapter
+
+import "log"
+
+// Trace logs every unit passing through it unchanged,
+// it can sit between any two layers carrying T.
+type Trace[T any] struct {
+	name string
+}
+
+func NewTrace[T any](name string) *Trace[T] {
+	return &Trace[T]{
+		name: name,
+	}
+}
+
+func (t *Trace[T]) Receive(unit T) ([]T, error) {
+	log.Printf("[%s rx]: %v", t.name, unit)
+	return []T{unit}, nil
+}
+
+func (t *Trace[T]) Send(unit T) ([]T, error) {
+	log.Printf("[%s tx]: %v", t.name, unit)
+	return []T{unit}, nil
+}
@@ -1,17 +1,41 @@
 package adapter
 
-import "github.com/shakram02/nony-chat/adapters/websockets"
+import (
+	"io"
 
+	"github.com/shakram02/nony-chat/adapters/websockets"
+)
+
+// Websocket cuts the byte stream into frames.
 type Websocket struct {
-	canReceive bool
+	decoder *websockets.FrameDecoder
+}
+
+func NewWebsocket(maxPayloadLength uint64) *Websocket {
+	decoder := websockets.NewFrameDecoder()
+	decoder.SetMaxPayloadLength(maxPayloadLength)
+
+	return &Websocket{
+		decoder: decoder,
+	}
 }
 
-func (w *Websocket) CanReceive() bool {
-	panic("not implemented")
+// EnableCompression accepts compressed frames once
+// permessage-deflate is negotiated.
+func (w *Websocket) EnableCompression() {
+	w.decoder.EnableCompression()
 }
-func (w *Websocket) Receive([]byte) *websockets.Frame {
-	panic("not implemented")
+
+func (w *Websocket) Receive(chunk []byte) ([]*websockets.Frame, error) {
+	return w.decoder.Push(chunk)
+}
+
+// NextFrame hands out the next frame with its payload read off the
+// stream as it's consumed, rather than received whole.
+func (w *Websocket) NextFrame(stream io.Reader) (*websockets.Frame, io.Reader, error) {
+	return w.decoder.NextFrame(stream)
 }
-func (w *Websocket) Send(frame *websockets.Frame) []byte {
-	panic("not implemented")
+
+func (w *Websocket) Send(frame *websockets.Frame) ([][]byte, error) {
+	return [][]byte{frame.Encode()}, nil
 }
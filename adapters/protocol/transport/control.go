@@ -0,0 +1,192 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/shakram02/nony-chat/adapters/websockets"
+)
+
+// How long closing waits for the close frame to be written, a peer
+// that stopped reading can't hold the connection open.
+const closeFrameTimeout = time.Second
+
+// Control answers pings and runs the close handshake on top of the
+// message layer, the layers above it only see data messages.
+type Control struct {
+	messages Transport[*websockets.Message]
+
+	isCloseSent atomic.Bool
+}
+
+func NewControl(messages Transport[*websockets.Message]) *Control {
+	return &Control{
+		messages: messages,
+	}
+}
+
+// Read blocks until a data message arrives. Once the peer closes the
+// connection the close handshake is completed and a
+// *websockets.CloseError holding the peer's status code is returned.
+// The connection stays open if the context is done first.
+func (c *Control) Read(ctx context.Context) (*websockets.Message, error) {
+	for {
+		message, err := c.messages.Read(ctx)
+		if isContextErr(err) {
+			return nil, err
+		}
+
+		if err != nil {
+			c.fail(err)
+			return nil, fmt.Errorf("failed to read message: %w", err)
+		}
+
+		if !message.IsControl() {
+			return message, nil
+		}
+
+		err = c.handleControl(ctx, message)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// MessageStreamer is implemented by message layers able to stream a
+// message frame by frame, the control messages met on the way are
+// handed to onControl.
+type MessageStreamer interface {
+	StreamReader(ctx context.Context, onControl websockets.ControlHandler) (websockets.FrameOpCode, io.Reader, error)
+	StreamWriter(ctx context.Context, opCode websockets.FrameOpCode) (io.WriteCloser, error)
+}
+
+// NextReader streams the next data message without holding it whole,
+// pings met on the way are answered. A message left partially read is
+// discarded by the next call. Read and NextReader must not be mixed in
+// the middle of a message. The whole message is read under the context.
+func (c *Control) NextReader(ctx context.Context) (websockets.FrameOpCode, io.Reader, error) {
+	streamer, ok := c.messages.(MessageStreamer)
+	if !ok {
+		return websockets.OpContinuationFrame, nil, ErrStreamingUnsupported
+	}
+
+	onControl := func(message *websockets.Message) error {
+		return c.handleControl(ctx, message)
+	}
+
+	opCode, message, err := streamer.StreamReader(ctx, onControl)
+	if err != nil {
+		c.failUnlessContext(err)
+		return opCode, nil, fmt.Errorf("failed to read message: %w", err)
+	}
+
+	return opCode, &messageStream{reader: message, control: c}, nil
+}
+
+// NextWriter streams a data message, the final frame is sent on Close.
+// Other data messages wait until the writer is closed.
+func (c *Control) NextWriter(ctx context.Context, opCode websockets.FrameOpCode) (io.WriteCloser, error) {
+	streamer, ok := c.messages.(MessageStreamer)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+
+	return streamer.StreamWriter(ctx, opCode)
+}
+
+// messageStream fails the connection if reading the message fails.
+type messageStream struct {
+	reader  io.Reader
+	control *Control
+}
+
+func (m *messageStream) Read(buffer []byte) (int, error) {
+	n, err := m.reader.Read(buffer)
+	if err != nil && err != io.EOF {
+		m.control.failUnlessContext(err)
+	}
+
+	return n, err
+}
+
+func (c *Control) handleControl(ctx context.Context, message *websockets.Message) error {
+	switch message.OpCode {
+	case websockets.OpPing:
+		// A Pong frame sent in response to a Ping frame must have
+		// identical "Application data" as found in the message body
+		// of the Ping frame being replied to.
+		err := c.Write(ctx, &websockets.Message{OpCode: websockets.OpPong, Data: message.Data})
+		if err != nil {
+			c.messages.Close()
+			return fmt.Errorf("failed to reply to ping: %w", err)
+		}
+	case websockets.OpPong:
+		// Unsolicited pongs are a heartbeat, no response is expected.
+	case websockets.OpConnectionClose:
+		closeErr, err := websockets.ParseCloseMessage(message.Data)
+		if err != nil {
+			c.fail(err)
+			return err
+		}
+
+		// When sending a Close frame in response, the endpoint
+		// typically echos the status code it received.
+		c.CloseWithCode(closeErr.Code, "")
+		return closeErr
+	}
+
+	return nil
+}
+
+func (c *Control) Write(ctx context.Context, message *websockets.Message) error {
+	return c.messages.Write(ctx, message)
+}
+
+// CloseWithCode sends a close frame then closes the connection.
+// After sending a Close frame, the endpoint MUST NOT send any further
+// data frames.
+func (c *Control) CloseWithCode(code websockets.CloseCode, reason string) error {
+	// Only the first close sends a frame, whichever goroutine it's on.
+	if c.isCloseSent.CompareAndSwap(false, true) {
+		// The peer might be gone already, the connection is closed regardless.
+		ctx, cancel := context.WithTimeout(context.Background(), closeFrameTimeout)
+		defer cancel()
+		c.Write(ctx, websockets.NewCloseMessage(code, reason))
+	}
+
+	return c.messages.Close()
+}
+
+// fail closes the connection with the status code matching the error,
+// if the peer can still receive it. The peer closing the connection is
+// already handled.
+func (c *Control) fail(err error) {
+	var closeErr *websockets.CloseError
+	if errors.As(err, &closeErr) {
+		return
+	}
+
+	code := websockets.CloseCodeFor(err)
+	if code == websockets.CloseAbnormalClosure {
+		c.messages.Close()
+		return
+	}
+
+	c.CloseWithCode(code, err.Error())
+}
+
+// failUnlessContext fails the connection unless the context is done,
+// the connection is still usable then.
+func (c *Control) failUnlessContext(err error) {
+	if !isContextErr(err) {
+		c.fail(err)
+	}
+}
+
+func (c *Control) Close() error {
+	return c.CloseWithCode(websockets.CloseNormalClosure, "")
+}
@@ -0,0 +1,45 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/shakram02/nony-chat/adapters/protocol/adapter"
+	"github.com/shakram02/nony-chat/adapters/websockets"
+)
+
+// Frames cuts the byte stream into frames like any layer, it can also
+// hand out a frame with its payload read off the connection as it's
+// consumed, so a large frame doesn't have to be held whole.
+type Frames struct {
+	*Layer[*websockets.Frame, []byte]
+	tcpTransport *Tcp
+	adapter      *adapter.Websocket
+}
+
+func NewFrames(tcpTransport *Tcp, frameAdapter *adapter.Websocket) *Frames {
+	return &Frames{
+		Layer:        Stack(tcpTransport, frameAdapter),
+		tcpTransport: tcpTransport,
+		adapter:      frameAdapter,
+	}
+}
+
+// NextFrame returns the next frame, its payload is read and unmasked as
+// it's consumed, under the context. The maximum payload length doesn't
+// apply. The payload must be read whole before the next frame is read.
+func (f *Frames) NextFrame(ctx context.Context) (*websockets.Frame, io.Reader, error) {
+	// Frames a read already completed come first.
+	if len(f.received) > 0 {
+		frame := f.received[0]
+		f.received = f.received[1:]
+		return frame, bytes.NewReader(frame.Data), nil
+	}
+
+	if f.err != nil {
+		return nil, nil, f.err
+	}
+
+	return f.adapter.NextFrame(f.tcpTransport.Reader(ctx))
+}
@@ -0,0 +1,31 @@
+package transport
+
+import "github.com/shakram02/nony-chat/adapters/metrics"
+
+// HandshakeGate caps the handshakes in progress at once, so clients that
+// connect and stall can't hold every goroutine and file descriptor.
+type HandshakeGate struct {
+	slots chan struct{}
+}
+
+func NewHandshakeGate(maxPending int) *HandshakeGate {
+	return &HandshakeGate{
+		slots: make(chan struct{}, maxPending),
+	}
+}
+
+// TryEnter takes a slot without waiting, false when all are taken.
+func (g *HandshakeGate) TryEnter() bool {
+	select {
+	case g.slots <- struct{}{}:
+		metrics.PendingHandshakes.Add(1)
+		return true
+	default:
+		return false
+	}
+}
+
+func (g *HandshakeGate) Leave() {
+	<-g.slots
+	metrics.PendingHandshakes.Add(-1)
+}
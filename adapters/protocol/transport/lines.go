@@ -0,0 +1,154 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shakram02/nony-chat/adapters/auth"
+	"github.com/shakram02/nony-chat/adapters/metrics"
+	"github.com/shakram02/nony-chat/adapters/nony"
+	"github.com/shakram02/nony-chat/adapters/protocol/adapter"
+)
+
+var (
+	ErrInvalidLogin  = errors.New("Invalid login token")
+	ErrLoginTimeout  = errors.New("Login timed out")
+	ErrTooManyLogins = errors.New("Too many pending logins")
+	ErrIdleTimeout   = errors.New("Client idle for too long")
+)
+
+// LineSocket serves a client speaking a packet a line, for clients
+// typing in a terminal: bytes → lines → packets. There's no handshake,
+// the connection speaks packets as soon as it's accepted. With a signer,
+// the client logs in by sending its token on the first line, the way
+// a websocket client sends it with its handshake.
+type LineSocket struct {
+	tcpTransport *Tcp
+	lines        *Layer[[]byte, []byte]
+	packets      *Layer[*nony.Packet, []byte]
+
+	signer   *auth.Signer
+	identity *auth.Identity
+
+	loginGate    *HandshakeGate
+	loginTimeout time.Duration
+	idleTimeout  time.Duration
+}
+
+func NewLineSocket(tcpTransport *Tcp, maxLineLength uint64) *LineSocket {
+	lines := Stack(tcpTransport, adapter.NewLines(int(maxLineLength)))
+	return &LineSocket{
+		tcpTransport: tcpTransport,
+		lines:        lines,
+		packets:      Stack(lines, adapter.NewLinePackets(nony.CodecFor(""))),
+	}
+}
+
+// SetSigner requires clients to log in with a token it signed, packets
+// are then only accepted for the user the token was issued to.
+func (l *LineSocket) SetSigner(signer *auth.Signer) {
+	l.signer = signer
+}
+
+// Identity is the logged in user, nil without a signer.
+func (l *LineSocket) Identity() *auth.Identity {
+	return l.identity
+}
+
+// SetLoginLimits bounds how long clients may take to log in and shares
+// a cap on pending logins between sockets. Zero and nil don't limit.
+func (l *LineSocket) SetLoginLimits(timeout time.Duration, gate *HandshakeGate) {
+	l.loginTimeout = timeout
+	l.loginGate = gate
+}
+
+// SetIdleTimeout drops clients that don't send a line for that long,
+// zero keeps them forever.
+func (l *LineSocket) SetIdleTimeout(timeout time.Duration) {
+	l.idleTimeout = timeout
+}
+
+// Start logs the client in, there's nothing to do without a signer.
+// The connection is closed if it fails.
+func (l *LineSocket) Start(ctx context.Context) error {
+	if l.signer == nil {
+		return nil
+	}
+
+	// A login is a line client's handshake, it's counted as one.
+	if l.loginGate != nil {
+		if !l.loginGate.TryEnter() {
+			metrics.ShedHandshakes.Add(1)
+			l.tcpTransport.Close()
+			return ErrTooManyLogins
+		}
+		defer l.loginGate.Leave()
+	}
+
+	// The timeout covers the whole login, so a client
+	// dripping bytes can't keep extending it.
+	ctx, cancel, isOwnDeadline := withTimeout(ctx, l.loginTimeout)
+	defer cancel()
+
+	line, err := l.lines.Read(ctx)
+	if errors.Is(err, context.DeadlineExceeded) && isOwnDeadline {
+		metrics.TimedOutHandshakes.Add(1)
+		l.tcpTransport.Close()
+		return fmt.Errorf("%w: %w", ErrLoginTimeout, err)
+	}
+
+	if err != nil {
+		l.tcpTransport.Close()
+		return err
+	}
+
+	identity, err := l.signer.Verify(strings.TrimSpace(string(line)))
+	if err != nil {
+		l.tcpTransport.Close()
+		return fmt.Errorf("%w: %w", ErrInvalidLogin, err)
+	}
+
+	l.identity = &identity
+	return nil
+}
+
+// Read returns the next packet, nil if it couldn't be decoded. The
+// connection is left open if the context is done first, and closed if
+// the client stays idle past the idle timeout.
+func (l *LineSocket) Read(ctx context.Context) (*nony.Packet, error) {
+	ctx, cancel, isOwnDeadline := withTimeout(ctx, l.idleTimeout)
+	defer cancel()
+
+	packet, err := l.packets.Read(ctx)
+	if errors.Is(err, context.DeadlineExceeded) && isOwnDeadline {
+		l.packets.Close()
+		return nil, fmt.Errorf("%w: %w", ErrIdleTimeout, err)
+	}
+
+	if isContextErr(err) {
+		return nil, err
+	}
+
+	if err != nil {
+		l.packets.Close()
+		return nil, fmt.Errorf("failed to read line packet: %w", err)
+	}
+
+	if packet != nil && l.identity != nil && packet.UserId != l.identity.UserId {
+		l.packets.Close()
+		return nil, fmt.Errorf("%w: %s", ErrIdentityMismatch, packet.UserId)
+	}
+
+	return packet, nil
+}
+
+func (l *LineSocket) Write(ctx context.Context, packet *nony.Packet) error {
+	return l.packets.Write(ctx, packet)
+}
+
+func (l *LineSocket) Close() error {
+	return l.packets.Close()
+}
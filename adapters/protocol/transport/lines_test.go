@@ -0,0 +1,219 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/shakram02/nony-chat/adapters/auth"
+	"github.com/shakram02/nony-chat/adapters/nony"
+	"github.com/shakram02/nony-chat/adapters/protocol/adapter"
+)
+
+func TestLineSocket(t *testing.T) {
+	cases := []struct {
+		description string
+		stream      string
+		expected    []string
+		err         error
+	}{
+		{
+			description: "a packet a line",
+			stream:      "{\"type\":\"join\",\"userId\":\"alice\"}\n{\"type\":\"message\",\"userId\":\"alice\"}\n",
+			expected:    []string{"alice/join", "alice/message"},
+			err:         io.EOF,
+		},
+		{
+			description: "terminal line endings and blank lines",
+			stream:      "\r\n{\"type\":\"join\",\"userId\":\"alice\"}\r\n  \n",
+			expected:    []string{"alice/join"},
+			err:         io.EOF,
+		},
+		{
+			description: "undecodable line",
+			stream:      "hello\n",
+			expected:    []string{"nil"},
+			err:         io.EOF,
+		},
+		{
+			description: "line too long",
+			stream:      "{\"type\":\"join\",\"userId\":\"alice\"}\n{\"type\":\"message\",\"userId\":\"alice\",\"content\":{\"text\":\"too long\"}}\n",
+			expected:    []string{"alice/join"},
+			err:         adapter.ErrLineTooLong,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			server, client := net.Pipe()
+			packets := NewLineSocket(NewTcp(server, 8), 48)
+			defer packets.Close()
+
+			go func() {
+				client.Write([]byte(c.stream))
+				client.Close()
+			}()
+
+			read := []string{}
+			for {
+				packet, err := packets.Read(context.Background())
+				if err != nil {
+					if !errors.Is(err, c.err) {
+						t.Errorf("Expected [%v] found [%v]", c.err, err)
+					}
+					break
+				}
+
+				if packet == nil {
+					read = append(read, "nil")
+				} else {
+					read = append(read, packet.UserId+"/"+string(packet.Type))
+				}
+			}
+
+			if !slices.Equal(read, c.expected) {
+				t.Errorf("Expected %v found %v", c.expected, read)
+			}
+		})
+	}
+}
+
+func TestLineSocketWrite(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	packets := NewLineSocket(NewTcp(server, 64), 1<<20)
+
+	received := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(client)
+		received <- data
+	}()
+
+	err := packets.Write(context.Background(), &nony.Packet{Type: nony.NonyPacketTypeJoin, UserId: "alice", RoomId: "lobby"})
+	if err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	packets.Close()
+
+	expected := `{"type":"join","userId":"alice","roomId":"lobby","content":null,"timestamp":"0001-01-01T00:00:00Z"}` + "\n"
+	if data := <-received; string(data) != expected {
+		t.Errorf("Expected [%s] found [%s]", expected, data)
+	}
+}
+
+func TestLineSocketLogin(t *testing.T) {
+	signer := auth.NewSigner([]byte("secret"))
+	token, _ := signer.Sign("alice", time.Hour)
+	otherToken, _ := auth.NewSigner([]byte("other secret")).Sign("alice", time.Hour)
+
+	cases := []struct {
+		description string
+		stream      string
+		isGateFull  bool
+		loginErr    error
+		readErr     error
+	}{
+		{
+			description: "logged in",
+			stream:      token + "\r\n{\"type\":\"join\",\"userId\":\"alice\"}\n",
+		},
+		{
+			description: "posting as someone else",
+			stream:      token + "\n{\"type\":\"join\",\"userId\":\"bob\"}\n",
+			readErr:     ErrIdentityMismatch,
+		},
+		{
+			description: "token of another secret",
+			stream:      otherToken + "\n",
+			loginErr:    auth.ErrBadSignature,
+		},
+		{
+			description: "packet instead of a token",
+			stream:      "{\"type\":\"join\",\"userId\":\"alice\"}\n",
+			loginErr:    ErrInvalidLogin,
+		},
+		{
+			description: "silent client",
+			loginErr:    ErrLoginTimeout,
+		},
+		{
+			description: "too many pending logins",
+			stream:      token + "\n",
+			isGateFull:  true,
+			loginErr:    ErrTooManyLogins,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+
+			gate := NewHandshakeGate(1)
+			if c.isGateFull {
+				gate.TryEnter()
+				defer gate.Leave()
+			}
+
+			socket := NewLineSocket(NewTcp(server, 64), 1024)
+			socket.SetSigner(signer)
+			socket.SetLoginLimits(20*time.Millisecond, gate)
+			defer socket.Close()
+
+			go client.Write([]byte(c.stream))
+
+			err := socket.Start(context.Background())
+			if !errors.Is(err, c.loginErr) {
+				t.Fatalf("Expected [%v] found [%v]", c.loginErr, err)
+			}
+
+			if c.loginErr != nil {
+				return
+			}
+
+			if identity := socket.Identity(); identity == nil || identity.UserId != "alice" {
+				t.Errorf("Expected to be logged in as [alice] found [%v]", identity)
+			}
+
+			_, err = socket.Read(context.Background())
+			if !errors.Is(err, c.readErr) {
+				t.Errorf("Expected [%v] found [%v]", c.readErr, err)
+			}
+		})
+	}
+}
+
+func TestLineSocketIdle(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	socket := NewLineSocket(NewTcp(server, 64), 1024)
+	socket.SetIdleTimeout(20 * time.Millisecond)
+
+	err := socket.Start(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no login without a signer found [%v]", err)
+	}
+
+	go client.Write([]byte("{\"type\":\"join\",\"userId\":\"alice\"}\n"))
+	packet, err := socket.Read(context.Background())
+	if err != nil || packet.UserId != "alice" {
+		t.Fatalf("Expected alice's packet found [%+v] %v", packet, err)
+	}
+
+	_, err = socket.Read(context.Background())
+	if !errors.Is(err, ErrIdleTimeout) {
+		t.Errorf("Expected [%v] found [%v]", ErrIdleTimeout, err)
+	}
+
+	// Idle clients are disconnected.
+	_, err = client.Read(make([]byte, 1))
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("Expected the connection to be closed found [%v]", err)
+	}
+}
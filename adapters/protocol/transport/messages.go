@@ -0,0 +1,161 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/shakram02/nony-chat/adapters/protocol/adapter"
+	"github.com/shakram02/nony-chat/adapters/websockets"
+)
+
+var ErrMessageDropped = errors.New("Message dropped midway, the connection is out of sync")
+
+// Messages joins frames into messages like any layer, it can also
+// stream a message off the connection without holding it whole.
+type Messages struct {
+	*Layer[*websockets.Message, *websockets.Frame]
+	frames    *Frames
+	adapter   *adapter.Message
+	chunkSize int
+
+	// Held by the data message being written, a streamed one holds
+	// it until it's closed. Control messages don't wait for it.
+	dataSlot chan struct{}
+
+	// The message being streamed by StreamReader, if any.
+	message io.Reader
+}
+
+// NewMessages stacks the adapter on the frames, streamed messages are
+// sent in frames of up to chunkSize bytes.
+func NewMessages(frames *Frames, messageAdapter *adapter.Message, chunkSize int) *Messages {
+	return &Messages{
+		Layer:     Stack(frames, messageAdapter),
+		frames:    frames,
+		adapter:   messageAdapter,
+		chunkSize: chunkSize,
+		dataSlot:  make(chan struct{}, 1),
+	}
+}
+
+// Write sends the message in a single frame. Data messages wait for a
+// streamed one to be closed, control messages may go between its
+// frames. Compressing a message moves the window the peer decompresses
+// with, so the connection is closed if a compressed one isn't sent.
+func (m *Messages) Write(ctx context.Context, message *websockets.Message) error {
+	if message.IsControl() {
+		return m.Layer.Write(ctx, message)
+	}
+
+	err := m.takeDataSlot(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.releaseDataSlot()
+
+	err = m.Layer.Write(ctx, message)
+	if err != nil && m.adapter.Deflate() != nil {
+		m.Layer.Close()
+		return fmt.Errorf("%w: %v", ErrMessageDropped, err)
+	}
+
+	return err
+}
+
+func (m *Messages) takeDataSlot(ctx context.Context) error {
+	select {
+	case m.dataSlot <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *Messages) releaseDataSlot() {
+	<-m.dataSlot
+}
+
+// StreamReader streams the next data message, control messages met on
+// the way are handed to onControl. The maximum message size doesn't
+// apply. A message left partially read is discarded by the next call,
+// Read and StreamReader must not be mixed in the middle of a message.
+// The whole message is read under the context.
+func (m *Messages) StreamReader(ctx context.Context, onControl websockets.ControlHandler) (websockets.FrameOpCode, io.Reader, error) {
+	if m.message != nil {
+		_, err := io.Copy(io.Discard, m.message)
+		if err != nil {
+			return websockets.OpContinuationFrame, nil, err
+		}
+		m.message = nil
+	}
+
+	source := &frameSource{ctx: ctx, frames: m.frames}
+	opCode, message, err := websockets.NextMessage(source, onControl, m.adapter.Deflate())
+	if err != nil {
+		return opCode, nil, err
+	}
+
+	// The whole stream is drained so the decompression
+	// context is kept up to date.
+	m.message = message
+	return opCode, message, nil
+}
+
+// StreamWriter streams a data message, a frame is sent every chunk size
+// bytes and the final one is sent on Close. Other data messages wait
+// until the writer is closed. Every frame is written under the context,
+// the connection is closed if one isn't sent since the peer can't tell
+// where the message ended.
+func (m *Messages) StreamWriter(ctx context.Context, opCode websockets.FrameOpCode) (io.WriteCloser, error) {
+	err := m.takeDataSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	writeFrame := func(frame *websockets.Frame) error {
+		err := m.frames.Write(ctx, frame)
+		if err != nil {
+			m.Layer.Close()
+			return fmt.Errorf("%w: %v", ErrMessageDropped, err)
+		}
+
+		return nil
+	}
+
+	writer, err := websockets.NewMessageWriter(opCode, m.chunkSize, m.adapter.Deflate(), writeFrame)
+	if err != nil {
+		m.releaseDataSlot()
+		return nil, err
+	}
+
+	return &streamWriter{WriteCloser: writer, release: m.releaseDataSlot}, nil
+}
+
+// streamWriter lets other data messages through once it's closed.
+type streamWriter struct {
+	io.WriteCloser
+	release  func()
+	isClosed bool
+}
+
+func (s *streamWriter) Close() error {
+	if s.isClosed {
+		return nil
+	}
+	s.isClosed = true
+
+	defer s.release()
+	return s.WriteCloser.Close()
+}
+
+// frameSource hands out the frames of the layer under the context.
+type frameSource struct {
+	ctx    context.Context
+	frames *Frames
+}
+
+func (f *frameSource) NextFrame() (*websockets.Frame, io.Reader, error) {
+	return f.frames.NextFrame(f.ctx)
+}
@@ -1,66 +1,344 @@
 package transport
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"time"
 
+	"github.com/shakram02/nony-chat/adapters/auth"
 	"github.com/shakram02/nony-chat/adapters/http/handshaker"
 	http_parser "github.com/shakram02/nony-chat/adapters/http/parser"
+	"github.com/shakram02/nony-chat/adapters/http/router"
+	"github.com/shakram02/nony-chat/adapters/metrics"
 	"github.com/shakram02/nony-chat/adapters/nony"
+	"github.com/shakram02/nony-chat/adapters/protocol/adapter"
+	"github.com/shakram02/nony-chat/adapters/proxy"
+	"github.com/shakram02/nony-chat/adapters/websockets"
 )
 
 type NonySocket struct {
-	tcpTransport       *Tcp
-	websocketTransport *Websockets
+	tcpTransport     *Tcp
+	packets          Transport[*nony.Packet]
+	buildStack       StackBuilder
+	maxMessageSize   uint64
+	originPolicy     *handshaker.OriginPolicy
+	authenticator    *handshaker.TokenAuthenticator
+	router           *router.Router[Handler]
+	handler          Handler
+	request          router.Request
+	identity         *auth.Identity
+	protocols        []string
+	protocol         string
+	codec            nony.Codec
+	trustedProxies   proxy.TrustedProxies
+	client           handshaker.HandshakedClient
+	handshakeGate    *HandshakeGate
+	handshakeTimeout time.Duration
+	maxHeaderSize    int
 }
 
-func NewNony(
-	tcpTransport *Tcp,
-	websocketTransport *Websockets,
-) *NonySocket {
+var (
+	ErrIdentityMismatch = errors.New("Packet user doesn't match the authenticated user")
+	ErrHandshakeTimeout = errors.New("Handshake timed out")
+)
+
+// Handler serves a socket routed to it after the handshake,
+// until the context is cancelled.
+type Handler func(ctx context.Context, socket *NonySocket, request router.Request)
+
+// StackOptions are the ones negotiated in the handshake.
+type StackOptions struct {
+	MaxMessageSize uint64
+	// Nil unless permessage-deflate was negotiated.
+	Deflate *websockets.DeflateParams
+	Codec   nony.Codec
+}
+
+// StackBuilder stacks the layers carrying packets over
+// the TCP connection once the handshake is done.
+type StackBuilder func(tcpTransport *Tcp, options StackOptions) Transport[*nony.Packet]
+
+// NonyStack carries packets in websocket messages:
+// bytes → frames → messages → packets.
+func NonyStack(tcpTransport *Tcp, options StackOptions) Transport[*nony.Packet] {
+	frameAdapter := adapter.NewWebsocket(options.MaxMessageSize)
+	messageAdapter := adapter.NewMessage(options.MaxMessageSize)
+	if options.Deflate != nil {
+		frameAdapter.EnableCompression()
+		messageAdapter.EnableCompression(*options.Deflate)
+	}
+
+	frames := NewFrames(tcpTransport, frameAdapter)
+	messages := NewMessages(frames, messageAdapter, tcpTransport.bufferSize)
+	return Stack(NewControl(messages), adapter.NewNony(options.Codec))
+}
+
+func NewNony(tcpTransport *Tcp, maxMessageSize uint64) *NonySocket {
 	return &NonySocket{
-		tcpTransport:       tcpTransport,
-		websocketTransport: websocketTransport,
+		tcpTransport:   tcpTransport,
+		buildStack:     NonyStack,
+		maxMessageSize: maxMessageSize,
+		codec:          nony.CodecFor(""),
+		maxHeaderSize:  http_parser.DefaultMaxHeaderSize,
 	}
 }
 
-func (n *NonySocket) Start() error {
+// SetStack replaces the layers stacked once the handshake is done,
+// e.g. to trace them, NonyStack is used by default.
+func (n *NonySocket) SetStack(builder StackBuilder) {
+	n.buildStack = builder
+}
+
+// SetOriginPolicy restricts the origins allowed to connect,
+// any origin is allowed without a policy.
+func (n *NonySocket) SetOriginPolicy(policy *handshaker.OriginPolicy) {
+	n.originPolicy = policy
+}
+
+// SetAuthenticator requires clients to send a signed token, packets
+// are then only accepted for the user the token was issued to.
+func (n *NonySocket) SetAuthenticator(authenticator *handshaker.TokenAuthenticator) {
+	n.authenticator = authenticator
+}
+
+// Identity is the authenticated user, nil without an authenticator.
+func (n *NonySocket) Identity() *auth.Identity {
+	return n.identity
+}
+
+// SetProtocols sets the subprotocols the server speaks, the
+// client's most preferred one is chosen during the handshake.
+func (n *NonySocket) SetProtocols(protocols []string) {
+	n.protocols = protocols
+}
+
+// Protocol is the negotiated subprotocol, empty if none was.
+func (n *NonySocket) Protocol() string {
+	return n.protocol
+}
+
+// SetTrustedProxies trusts the Forwarded and X-Forwarded-For
+// headers sent by these proxies to tell the client's address.
+func (n *NonySocket) SetTrustedProxies(trusted proxy.TrustedProxies) {
+	n.trustedProxies = trusted
+}
+
+// Client describes the handshaked client, its address is the one
+// relayed by trusted proxies.
+func (n *NonySocket) Client() handshaker.HandshakedClient {
+	return n.client
+}
+
+// SetHandshakeLimits bounds how long the client may take to finish its
+// handshake and how large its headers may be, no timeout if zero.
+func (n *NonySocket) SetHandshakeLimits(timeout time.Duration, maxHeaderSize int) {
+	n.handshakeTimeout = timeout
+	n.maxHeaderSize = maxHeaderSize
+}
+
+// SetHandshakeGate shares a cap on pending handshakes between sockets,
+// clients over the cap are turned away.
+func (n *NonySocket) SetHandshakeGate(gate *HandshakeGate) {
+	n.handshakeGate = gate
+}
+
+// SetRouter rejects handshakes to paths without a handler,
+// any path is accepted without a router.
+func (n *NonySocket) SetRouter(router *router.Router[Handler]) {
+	n.router = router
+}
+
+// Route returns the handler matched by the handshake URI and the
+// request passed to it, the handler is nil without a router.
+func (n *NonySocket) Route() (Handler, router.Request) {
+	return n.handler, n.request
+}
+
+// Start runs the handshake, cancelling the context abandons it.
+func (n *NonySocket) Start(ctx context.Context) error {
+	// The timeout covers the whole handshake, so a client
+	// dripping bytes can't keep extending it.
+	ctx, cancel, isOwnDeadline := withTimeout(ctx, n.handshakeTimeout)
+	defer cancel()
+
+	if n.handshakeGate != nil {
+		if !n.handshakeGate.TryEnter() {
+			metrics.ShedHandshakes.Add(1)
+			return n.reject(ctx, handshaker.ErrTooManyHandshakes)
+		}
+		defer n.handshakeGate.Leave()
+	}
+
 	// Read HTTP upgrade request.
 	// Handhshake client
-	httpHandshake, err := n.tcpTransport.Read()
-	if err != nil {
-		n.tcpTransport.Write(handshaker.MakeRejectionResponse())
+	websocketHandshake, err := n.readHandshake(ctx)
+	// A deadline of the caller's isn't the client being slow.
+	if errors.Is(err, context.DeadlineExceeded) && isOwnDeadline {
+		metrics.TimedOutHandshakes.Add(1)
 		n.tcpTransport.Close()
-		return fmt.Errorf("Failed to read handshake: %v", err)
+		return fmt.Errorf("%w: %w", ErrHandshakeTimeout, err)
 	}
 
-	websocketHandshake, err := http_parser.ParseUpgradeRequest(httpHandshake)
-	if err != nil {
-		n.tcpTransport.Write(handshaker.MakeRejectionResponse())
+	if isContextErr(err) {
 		n.tcpTransport.Close()
-		return fmt.Errorf("Failed to parse upgrade request")
+		return err
+	}
+
+	if err != nil {
+		return n.reject(ctx, fmt.Errorf("Failed to parse upgrade request: %w", err))
+	}
+
+	n.client = handshaker.HandshakedClient{
+		RemoteAddr:       n.clientAddr(websocketHandshake),
+		SocketIdentifier: websocketHandshake.Headers.SecWebSocketKey,
+	}
+
+	if n.originPolicy != nil {
+		err = n.originPolicy.Check(websocketHandshake)
+		if err != nil {
+			return n.reject(ctx, err)
+		}
+	}
+
+	if n.authenticator != nil {
+		identity, err := n.authenticator.Authenticate(websocketHandshake)
+		if err != nil {
+			return n.reject(ctx, err)
+		}
+		n.identity = &identity
+	}
+
+	if n.router != nil {
+		n.handler, n.request, err = n.router.Match(websocketHandshake.RequestLine.Uri)
+		if err != nil {
+			return n.reject(ctx, err)
+		}
+	}
+
+	options := handshaker.AcceptOptions{}
+	stackOptions := StackOptions{MaxMessageSize: n.maxMessageSize}
+	offeredProtocols := websockets.ParseProtocols(websocketHandshake.Headers.SecWebSocketProtocol)
+	protocol, isProtocolAccepted := websockets.NegotiateProtocol(offeredProtocols, n.protocols)
+	if isProtocolAccepted {
+		options.Protocol = protocol
+		n.protocol = protocol
+		n.codec = nony.CodecFor(protocol)
 	}
 
-	handshakeResponse := handshaker.MakeAcceptanceResposne(websocketHandshake)
-	err = n.tcpTransport.Write(handshakeResponse)
+	extensionOffers := websockets.ParseExtensions(websocketHandshake.Headers.SecWebSocketExtensions)
+	deflateParams, isDeflateAccepted := websockets.NegotiateDeflate(extensionOffers)
+	if isDeflateAccepted {
+		options.Extensions = deflateParams.String()
+		stackOptions.Deflate = &deflateParams
+	}
+
+	handshakeResponse := handshaker.MakeAcceptanceResposne(websocketHandshake, options)
+	err = n.tcpTransport.Write(ctx, handshakeResponse)
 	if err != nil {
 		n.tcpTransport.Close()
 		return fmt.Errorf("Failed to send client handshake response")
 	}
 
+	stackOptions.Codec = n.codec
+	n.packets = n.buildStack(n.tcpTransport, stackOptions)
 	return nil
 }
 
-func (n *NonySocket) Read() (*nony.Packet, error) {
-	frame, err := n.websocketTransport.Read()
+func (n *NonySocket) clientAddr(websocketHandshake http_parser.WebsocketHandshake) string {
+	peer := n.tcpTransport.RemoteAddr()
+	tcpAddr, ok := peer.(*net.TCPAddr)
+	if !ok {
+		return peer.String()
+	}
+
+	return proxy.ClientIP(tcpAddr.IP, websocketHandshake.Fields, n.trustedProxies).String()
+}
+
+// reject answers a failed handshake and closes the connection.
+func (n *NonySocket) reject(ctx context.Context, err error) error {
+	n.tcpTransport.Write(ctx, handshaker.MakeRejectionResponse(err))
+	n.tcpTransport.Close()
+	return err
+}
+
+// readHandshake feeds the parser until the request is complete, bytes
+// the client sent after the request stay buffered for the frame reader.
+func (n *NonySocket) readHandshake(ctx context.Context) (http_parser.WebsocketHandshake, error) {
+	parser := http_parser.NewRequestParser(http_parser.DefaultMaxRequestLineSize, n.maxHeaderSize)
+	for {
+		buffered, err := n.tcpTransport.Peek(ctx)
+		if err != nil {
+			return http_parser.WebsocketHandshake{}, fmt.Errorf("Failed to read handshake: %w", err)
+		}
+
+		consumed, isDone, err := parser.Feed(buffered)
+		n.tcpTransport.Discard(consumed)
+		if err != nil {
+			return http_parser.WebsocketHandshake{}, err
+		}
+
+		if isDone {
+			return parser.Handshake()
+		}
+	}
+}
+
+// Read returns the next packet, nil if it couldn't be decoded. The
+// connection is left open if the context is done first.
+func (n *NonySocket) Read(ctx context.Context) (*nony.Packet, error) {
+	packet, err := n.packets.Read(ctx)
+	if isContextErr(err) {
+		return nil, err
+	}
+
 	if err != nil {
-		n.websocketTransport.Close()
+		n.packets.Close()
 		return nil, fmt.Errorf("failed to read websocket packet: %w", err)
 	}
 
-	packet := nony.New(frame)
+	if packet != nil && n.identity != nil && packet.UserId != n.identity.UserId {
+		closeWithCode(n.packets, websockets.ClosePolicyViolation, "User mismatch")
+		return nil, fmt.Errorf("%w: %s", ErrIdentityMismatch, packet.UserId)
+	}
+
 	return packet, nil
 }
 
-func (n *NonySocket) Close() {
-	n.websocketTransport.Close()
+func (n *NonySocket) Write(ctx context.Context, packet *nony.Packet) error {
+	return n.packets.Write(ctx, packet)
+}
+
+// NextReader streams the next data message as is, rather than decoding
+// a packet out of it, if the stack can stream. The packet identity
+// check doesn't apply.
+func (n *NonySocket) NextReader(ctx context.Context) (websockets.FrameOpCode, io.Reader, error) {
+	return nextReader(ctx, n.packets)
+}
+
+// NextWriter streams a data message as is, if the stack can stream.
+func (n *NonySocket) NextWriter(ctx context.Context, opCode websockets.FrameOpCode) (io.WriteCloser, error) {
+	return nextWriter(ctx, n.packets, opCode)
+}
+
+// CloseWithCode tells the client why the connection is closed,
+// e.g. the server going away.
+func (n *NonySocket) CloseWithCode(code websockets.CloseCode, reason string) {
+	if n.packets == nil {
+		n.tcpTransport.Close()
+		return
+	}
+
+	closeWithCode(n.packets, code, reason)
+}
+
+func (n *NonySocket) Close() error {
+	// Nothing is stacked before the handshake is done.
+	if n.packets == nil {
+		return n.tcpTransport.Close()
+	}
+
+	return n.packets.Close()
 }
@@ -0,0 +1,164 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/shakram02/nony-chat/adapters/metrics"
+)
+
+const upgradeRequest = "GET /chats HTTP/1.1\r\n" +
+	"Host: localhost\r\n" +
+	"Upgrade: websocket\r\n" +
+	"Connection: Upgrade\r\n" +
+	"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+	"Sec-WebSocket-Version: 13\r\n" +
+	"\r\n"
+
+func makeNony(conn net.Conn) *NonySocket {
+	tcpTransport := NewTcp(conn, 2048)
+	return NewNony(tcpTransport, 1<<20)
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	cases := []struct {
+		description      string
+		handshakeTimeout time.Duration
+		parentTimeout    time.Duration
+		expected         error
+		counted          int64
+	}{
+		{
+			description:      "client too slow",
+			handshakeTimeout: 20 * time.Millisecond,
+			parentTimeout:    time.Second,
+			expected:         ErrHandshakeTimeout,
+			counted:          1,
+		},
+		{
+			description:      "caller's deadline",
+			handshakeTimeout: time.Second,
+			parentTimeout:    20 * time.Millisecond,
+			expected:         context.DeadlineExceeded,
+			counted:          0,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+
+			socket := makeNony(server)
+			socket.SetHandshakeLimits(c.handshakeTimeout, 1024)
+
+			timedOut := metrics.TimedOutHandshakes.Value()
+			go client.Write([]byte("GET /chats HTTP/1.1\r\n"))
+
+			ctx, cancel := context.WithTimeout(context.Background(), c.parentTimeout)
+			defer cancel()
+
+			err := socket.Start(ctx)
+			if !errors.Is(err, c.expected) {
+				t.Errorf("Expected [%v] found [%v]", c.expected, err)
+			}
+
+			if c.expected != ErrHandshakeTimeout && errors.Is(err, ErrHandshakeTimeout) {
+				t.Errorf("Expected the caller's deadline not to be a handshake timeout")
+			}
+
+			if counted := metrics.TimedOutHandshakes.Value() - timedOut; counted != c.counted {
+				t.Errorf("Expected [%d] timed out handshakes found [%d]", c.counted, counted)
+			}
+		})
+	}
+}
+
+func TestHandshakeLimits(t *testing.T) {
+	cases := []struct {
+		description    string
+		request        string
+		maxHeaderSize  int
+		isGateFull     bool
+		expectedStatus int
+	}{
+		{
+			description:    "accepted",
+			request:        upgradeRequest,
+			maxHeaderSize:  1024,
+			expectedStatus: http.StatusSwitchingProtocols,
+		},
+		{
+			description:    "headers too large",
+			request:        upgradeRequest,
+			maxHeaderSize:  64,
+			expectedStatus: http.StatusRequestHeaderFieldsTooLarge,
+		},
+		{
+			description:    "too many pending handshakes",
+			request:        upgradeRequest,
+			maxHeaderSize:  1024,
+			isGateFull:     true,
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+
+			gate := NewHandshakeGate(1)
+			if c.isGateFull {
+				gate.TryEnter()
+				defer gate.Leave()
+			}
+
+			socket := makeNony(server)
+			socket.SetHandshakeLimits(time.Second, c.maxHeaderSize)
+			socket.SetHandshakeGate(gate)
+			go socket.Start(context.Background())
+
+			// A shed client is answered before its request is read.
+			if !c.isGateFull {
+				go client.Write([]byte(c.request))
+			}
+
+			response, err := http.ReadResponse(bufio.NewReader(client), nil)
+			if err != nil {
+				t.Fatalf("Failed to read response: %v", err)
+			}
+
+			if response.StatusCode != c.expectedStatus {
+				t.Errorf("Expected status [%d] found [%d]", c.expectedStatus, response.StatusCode)
+			}
+		})
+	}
+}
+
+func TestHandshakeGate(t *testing.T) {
+	gate := NewHandshakeGate(2)
+	pending := metrics.PendingHandshakes.Value()
+
+	if !gate.TryEnter() || !gate.TryEnter() {
+		t.Fatalf("Expected two slots")
+	}
+
+	if gate.TryEnter() {
+		t.Errorf("Expected the gate to be full")
+	}
+
+	if metrics.PendingHandshakes.Value() != pending+2 {
+		t.Errorf("Expected [%d] pending found [%d]", pending+2, metrics.PendingHandshakes.Value())
+	}
+
+	gate.Leave()
+	if !gate.TryEnter() {
+		t.Errorf("Expected a slot to free up")
+	}
+}
@@ -0,0 +1,71 @@
+package transport
+
+import (
+	"context"
+	"sync"
+)
+
+// Pipe is one end of an in-memory transport, what's written to one end
+// is read from the other. Units aren't copied. Closing either end
+// closes both, units already written can still be read.
+type Pipe[T any] struct {
+	inbound  chan T
+	outbound chan T
+	closed   chan struct{}
+	// Shared by both ends.
+	closeOnce *sync.Once
+}
+
+// NewPipe connects two ends, each buffering up to queueSize
+// units before writes block.
+func NewPipe[T any](queueSize int) (*Pipe[T], *Pipe[T]) {
+	a := make(chan T, queueSize)
+	b := make(chan T, queueSize)
+	closed := make(chan struct{})
+	closeOnce := &sync.Once{}
+
+	return &Pipe[T]{inbound: a, outbound: b, closed: closed, closeOnce: closeOnce},
+		&Pipe[T]{inbound: b, outbound: a, closed: closed, closeOnce: closeOnce}
+}
+
+func (p *Pipe[T]) Read(ctx context.Context) (T, error) {
+	// Units written before closing come first.
+	select {
+	case unit := <-p.inbound:
+		return unit, nil
+	default:
+	}
+
+	select {
+	case unit := <-p.inbound:
+		return unit, nil
+	case <-p.closed:
+		var zero T
+		return zero, ErrClosed
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+func (p *Pipe[T]) Write(ctx context.Context, unit T) error {
+	select {
+	case <-p.closed:
+		return ErrClosed
+	default:
+	}
+
+	select {
+	case p.outbound <- unit:
+		return nil
+	case <-p.closed:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pipe[T]) Close() error {
+	p.closeOnce.Do(func() { close(p.closed) })
+	return nil
+}
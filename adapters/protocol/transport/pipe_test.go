@@ -0,0 +1,46 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPipe(t *testing.T) {
+	a, b := NewPipe[string](2)
+
+	for _, unit := range []string{"hello", "world"} {
+		err := a.Write(context.Background(), unit)
+		if err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+
+	// The queue is full until the other end reads.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := a.Write(ctx, "!")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected [%v] found [%v]", context.DeadlineExceeded, err)
+	}
+
+	b.Close()
+
+	for _, expected := range []string{"hello", "world"} {
+		unit, err := b.Read(context.Background())
+		if err != nil || unit != expected {
+			t.Errorf("Expected [%s] written before closing found [%s] %v", expected, unit, err)
+		}
+	}
+
+	_, err = b.Read(context.Background())
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected [%v] found [%v]", ErrClosed, err)
+	}
+
+	err = a.Write(context.Background(), "hello")
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected [%v] found [%v]", ErrClosed, err)
+	}
+}
@@ -0,0 +1,139 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/shakram02/nony-chat/adapters/protocol/adapter"
+	"github.com/shakram02/nony-chat/adapters/websockets"
+)
+
+// Layer carries higher units over a transport of lower ones, the
+// adapter buffers what's read and decomposes what's written. Layers
+// stack into a single transport, e.g. bytes → frames → messages. A
+// layer is safe for one reader and any number of writers.
+type Layer[THigher any, TLower any] struct {
+	lower   Transport[TLower]
+	adapter adapter.Adapter[THigher, TLower]
+	// Adapters may keep state across writes, e.g. a compression
+	// window, so units must go down in the order they're sent.
+	writeMu sync.Mutex
+
+	// Units completed by the last read and not returned yet.
+	received []THigher
+	// Units completed ahead of a failed one are returned first.
+	err error
+}
+
+// Stack puts the adapter on top of the lower transport.
+func Stack[THigher any, TLower any](lower Transport[TLower], adapter adapter.Adapter[THigher, TLower]) *Layer[THigher, TLower] {
+	return &Layer[THigher, TLower]{
+		lower:   lower,
+		adapter: adapter,
+	}
+}
+
+// Read blocks until the adapter completes a unit, reading as many lower
+// units as that takes.
+func (l *Layer[THigher, TLower]) Read(ctx context.Context) (THigher, error) {
+	for len(l.received) == 0 {
+		if l.err != nil {
+			var zero THigher
+			return zero, l.err
+		}
+
+		unit, err := l.lower.Read(ctx)
+		if err != nil {
+			var zero THigher
+			return zero, err
+		}
+
+		l.received, l.err = l.adapter.Receive(unit)
+	}
+
+	unit := l.received[0]
+	l.received = l.received[1:]
+	return unit, nil
+}
+
+func (l *Layer[THigher, TLower]) Write(ctx context.Context, unit THigher) error {
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+
+	units, err := l.adapter.Send(unit)
+	if err != nil {
+		return err
+	}
+
+	for _, lower := range units {
+		err = l.lower.Write(ctx, lower)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *Layer[THigher, TLower]) Close() error {
+	return l.lower.Close()
+}
+
+// CloseWithCode passes the status code down to the
+// layer that can send it, if there's one.
+func (l *Layer[THigher, TLower]) CloseWithCode(code websockets.CloseCode, reason string) error {
+	return closeWithCode(l.lower, code, reason)
+}
+
+// NextReader passes streaming down to the layer that can stream.
+func (l *Layer[THigher, TLower]) NextReader(ctx context.Context) (websockets.FrameOpCode, io.Reader, error) {
+	return nextReader(ctx, l.lower)
+}
+
+func (l *Layer[THigher, TLower]) NextWriter(ctx context.Context, opCode websockets.FrameOpCode) (io.WriteCloser, error) {
+	return nextWriter(ctx, l.lower, opCode)
+}
+
+// CodeCloser is implemented by transports able to tell
+// the peer why the connection is closed.
+type CodeCloser interface {
+	CloseWithCode(code websockets.CloseCode, reason string) error
+}
+
+func closeWithCode[T any](transport Transport[T], code websockets.CloseCode, reason string) error {
+	closer, ok := transport.(CodeCloser)
+	if !ok {
+		return transport.Close()
+	}
+
+	return closer.CloseWithCode(code, reason)
+}
+
+var ErrStreamingUnsupported = errors.New("No layer of the stack streams messages")
+
+// Streamer is implemented by transports able to stream data messages
+// rather than holding them whole, e.g. to relay a large upload.
+type Streamer interface {
+	NextReader(ctx context.Context) (websockets.FrameOpCode, io.Reader, error)
+	NextWriter(ctx context.Context, opCode websockets.FrameOpCode) (io.WriteCloser, error)
+}
+
+func nextReader[T any](ctx context.Context, transport Transport[T]) (websockets.FrameOpCode, io.Reader, error) {
+	streamer, ok := transport.(Streamer)
+	if !ok {
+		return websockets.OpContinuationFrame, nil, ErrStreamingUnsupported
+	}
+
+	return streamer.NextReader(ctx)
+}
+
+func nextWriter[T any](ctx context.Context, transport Transport[T], opCode websockets.FrameOpCode) (io.WriteCloser, error) {
+	streamer, ok := transport.(Streamer)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+
+	return streamer.NextWriter(ctx, opCode)
+}
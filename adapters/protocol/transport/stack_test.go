@@ -0,0 +1,415 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shakram02/nony-chat/adapters/nony"
+	"github.com/shakram02/nony-chat/adapters/protocol/adapter"
+	"github.com/shakram02/nony-chat/adapters/websockets"
+)
+
+// clientFrame encodes a frame the way a client sends it, masked with
+// a zero key so the payload reads as is.
+func clientFrame(opCode websockets.FrameOpCode, payload string) []byte {
+	frame := []byte{0x80 | byte(opCode), 0x80 | byte(len(payload)), 0, 0, 0, 0}
+	return append(frame, payload...)
+}
+
+// serverFrame is what the server is expected to send.
+func serverFrame(opCode websockets.FrameOpCode, payload string) []byte {
+	return websockets.NewFrame(opCode, []byte(payload)).Encode()
+}
+
+func TestNonyStack(t *testing.T) {
+	cases := []struct {
+		description string
+		build       StackBuilder
+	}{
+		{
+			description: "default layers",
+			build:       NonyStack,
+		},
+		{
+			description: "traced messages",
+			build: func(tcpTransport *Tcp, options StackOptions) Transport[*nony.Packet] {
+				frames := Stack(tcpTransport, adapter.NewWebsocket(options.MaxMessageSize))
+				messages := Stack(frames, adapter.NewMessage(options.MaxMessageSize))
+				traced := Stack[*websockets.Message](messages, adapter.NewTrace[*websockets.Message]("messages"))
+				return Stack(NewControl(traced), adapter.NewNony(options.Codec))
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+
+			packets := c.build(NewTcp(server, 64), StackOptions{MaxMessageSize: 1 << 20, Codec: nony.CodecFor("")})
+
+			// A ping, then a packet split across writes, then a close.
+			packet := `{"type":"message","userId":"sherif","roomId":"1"}`
+			stream := clientFrame(websockets.OpPing, "hi")
+			stream = append(stream, clientFrame(websockets.OpTextFrame, packet)...)
+			stream = append(stream, clientFrame(websockets.OpConnectionClose, "\x03\xe8")...)
+			go func() {
+				for start := 0; start < len(stream); start += 5 {
+					client.Write(stream[start:min(start+5, len(stream))])
+				}
+			}()
+
+			expected := append(serverFrame(websockets.OpPong, "hi"), serverFrame(websockets.OpConnectionClose, "\x03\xe8")...)
+			received := make(chan []byte)
+			go func() {
+				data, _ := io.ReadAll(client)
+				received <- data
+			}()
+
+			read, err := packets.Read(context.Background())
+			if err != nil {
+				t.Fatalf("Failed to read: %v", err)
+			}
+
+			if read.UserId != "sherif" || read.RoomId != "1" {
+				t.Errorf("Expected the packet of [sherif] in [1] found [%+v]", read)
+			}
+
+			_, err = packets.Read(context.Background())
+			var closeErr *websockets.CloseError
+			if !errors.As(err, &closeErr) || closeErr.Code != websockets.CloseNormalClosure {
+				t.Errorf("Expected a normal closure found [%v]", err)
+			}
+
+			if data := <-received; string(data) != string(expected) {
+				t.Errorf("Expected a pong and the close echo, found [%x]", data)
+			}
+		})
+	}
+}
+
+func TestNonyStackWrite(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	packets := NonyStack(NewTcp(server, 64), StackOptions{MaxMessageSize: 1 << 20, Codec: nony.CodecFor("")})
+
+	packet := &nony.Packet{Type: nony.NonyPacketTypeJoin, UserId: "sherif", RoomId: "1"}
+	encoded, _ := nony.CodecFor("").Encode(packet)
+	expected := serverFrame(websockets.OpTextFrame, string(encoded))
+
+	go packets.Write(context.Background(), packet)
+
+	received := make([]byte, len(expected))
+	_, err := io.ReadFull(client, received)
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+
+	if string(received) != string(expected) {
+		t.Errorf("Expected [%x] found [%x]", expected, received)
+	}
+}
+
+func TestStackFailsWithCloseCode(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	packets := NonyStack(NewTcp(server, 64), StackOptions{MaxMessageSize: 1 << 20, Codec: nony.CodecFor("")})
+
+	// Client frames must be masked.
+	go client.Write(serverFrame(websockets.OpTextFrame, "{}"))
+	received := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(client)
+		received <- data
+	}()
+
+	_, err := packets.Read(context.Background())
+	if !errors.Is(err, websockets.ErrUnmaskedClientFrame) {
+		t.Errorf("Expected [%v] found [%v]", websockets.ErrUnmaskedClientFrame, err)
+	}
+
+	closeErr, _ := websockets.ParseCloseMessage((<-received)[2:])
+	if closeErr == nil || closeErr.Code != websockets.CloseProtocolError {
+		t.Errorf("Expected a protocol error close found [%v]", closeErr)
+	}
+}
+
+func TestStackReadCancelled(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	packets := NonyStack(NewTcp(server, 64), StackOptions{MaxMessageSize: 1 << 20, Codec: nony.CodecFor("")})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	_, err := packets.Read(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected [%v] found [%v]", context.Canceled, err)
+	}
+
+	// The connection wasn't failed, packets still come through.
+	go client.Write(clientFrame(websockets.OpTextFrame, `{"userId":"sherif"}`))
+
+	read, err := packets.Read(context.Background())
+	if err != nil || read.UserId != "sherif" {
+		t.Errorf("Expected the packet of [sherif] found [%+v] %v", read, err)
+	}
+}
+
+// fragment encodes a frame of a fragmented message, masked with
+// a zero key when sent by a client.
+func fragment(isFinal bool, isMasked bool, opCode websockets.FrameOpCode, payload string) []byte {
+	first := byte(opCode)
+	if isFinal {
+		first |= 0x80
+	}
+
+	if !isMasked {
+		return append([]byte{first, byte(len(payload))}, payload...)
+	}
+
+	frame := []byte{first, 0x80 | byte(len(payload)), 0, 0, 0, 0}
+	return append(frame, payload...)
+}
+
+func TestNonyStackStream(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	packets := NonyStack(NewTcp(server, 64), StackOptions{MaxMessageSize: 16, Codec: nony.CodecFor("")})
+	streamer, ok := packets.(Streamer)
+	if !ok {
+		t.Fatalf("Expected the stack to stream")
+	}
+
+	// Longer than the maximum message size, with a ping in between.
+	stream := fragment(false, true, websockets.OpTextFrame, "Hello, ")
+	stream = append(stream, clientFrame(websockets.OpPing, "hi")...)
+	stream = append(stream, fragment(false, true, websockets.OpContinuationFrame, "κόσμε")...)
+	stream = append(stream, fragment(true, true, websockets.OpContinuationFrame, ", streamed")...)
+	go client.Write(stream)
+
+	received := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(client)
+		received <- data
+	}()
+
+	opCode, message, err := streamer.NextReader(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+
+	data, err := io.ReadAll(message)
+	if err != nil || opCode != websockets.OpTextFrame || string(data) != "Hello, κόσμε, streamed" {
+		t.Errorf("Expected [Hello, κόσμε, streamed] found [%d] [%s] %v", opCode, data, err)
+	}
+
+	// Sent in frames of the buffer size.
+	writer, err := streamer.NextWriter(context.Background(), websockets.OpBinaryFrame)
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+
+	payload := strings.Repeat("a", 64) + strings.Repeat("b", 64) + "c"
+	writer.Write([]byte(payload[:100]))
+	writer.Write([]byte(payload[100:]))
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	packets.Close()
+
+	expected := serverFrame(websockets.OpPong, "hi")
+	expected = append(expected, fragment(false, false, websockets.OpBinaryFrame, payload[:64])...)
+	expected = append(expected, fragment(false, false, websockets.OpContinuationFrame, payload[64:128])...)
+	expected = append(expected, fragment(true, false, websockets.OpContinuationFrame, payload[128:])...)
+	expected = append(expected, serverFrame(websockets.OpConnectionClose, "\x03\xe8")...)
+	if data := <-received; string(data) != string(expected) {
+		t.Errorf("Expected [%x] found [%x]", expected, data)
+	}
+}
+
+// maskedFrame encodes a final frame the way a browser does, masked
+// with a random looking key.
+func maskedFrame(opCode websockets.FrameOpCode, payload []byte) []byte {
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame := []byte{0x80 | byte(opCode)}
+	if len(payload) < 126 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126, byte(len(payload)>>8), byte(len(payload)))
+	}
+
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%len(mask)])
+	}
+
+	return frame
+}
+
+func TestNonyStackStreamLargeFrame(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	packets := NonyStack(NewTcp(server, 64), StackOptions{MaxMessageSize: 1 << 10, Codec: nony.CodecFor("")})
+	streamer := packets.(Streamer)
+
+	// An upload sent in a single frame larger than the maximum message
+	// size, a message left unread, then a packet.
+	upload := make([]byte, 4<<10)
+	for i := range upload {
+		upload[i] = byte(i)
+	}
+	stream := maskedFrame(websockets.OpBinaryFrame, upload)
+	stream = append(stream, maskedFrame(websockets.OpBinaryFrame, []byte("skipped"))...)
+	stream = append(stream, maskedFrame(websockets.OpTextFrame, []byte(`{"type":"join","userId":"alice"}`))...)
+	go client.Write(stream)
+
+	opCode, message, err := streamer.NextReader(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+
+	data, err := io.ReadAll(message)
+	if err != nil || opCode != websockets.OpBinaryFrame || !bytes.Equal(data, upload) {
+		t.Fatalf("Expected the upload of length [%d] found [%d] of length [%d] %v", len(upload), opCode, len(data), err)
+	}
+
+	_, message, err = streamer.NextReader(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	message.Read(make([]byte, 3))
+
+	_, message, err = streamer.NextReader(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+
+	data, _ = io.ReadAll(message)
+	if string(data) != `{"type":"join","userId":"alice"}` {
+		t.Errorf("Expected the packet after the unread message found [%s]", data)
+	}
+}
+
+func newMessages(socket net.Conn, isCompressed bool) *Messages {
+	messageAdapter := adapter.NewMessage(1 << 10)
+	if isCompressed {
+		messageAdapter.EnableCompression(websockets.DeflateParams{})
+	}
+
+	frames := NewFrames(NewTcp(socket, 64), adapter.NewWebsocket(1<<10))
+	return NewMessages(frames, messageAdapter, 64)
+}
+
+func TestMessagesDroppedCompressedWrite(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	messages := newMessages(server, true)
+	defer messages.Close()
+
+	// Nobody reads the other end, writes block once the queue is full.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	var err error
+	for i := 0; i <= OutboundQueueSize+1 && err == nil; i++ {
+		err = messages.Write(ctx, &websockets.Message{OpCode: websockets.OpTextFrame, Data: []byte("hello")})
+	}
+
+	if !errors.Is(err, ErrMessageDropped) {
+		t.Fatalf("Expected [%v] found [%v]", ErrMessageDropped, err)
+	}
+
+	// The peer gets what was queued, then the connection is closed.
+	done := make(chan error)
+	go func() {
+		_, err := io.ReadAll(client)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected the connection to be closed found [%v]", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected the connection to be closed")
+	}
+}
+
+func TestMessagesStreamHoldsDataWrites(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	messages := newMessages(server, false)
+	received := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(client)
+		received <- data
+	}()
+
+	writer, err := messages.StreamWriter(context.Background(), websockets.OpBinaryFrame)
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+
+	payload := strings.Repeat("a", 70)
+	writer.Write([]byte(payload))
+
+	// Data messages wait for the streamed one, control messages don't.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = messages.Write(ctx, &websockets.Message{OpCode: websockets.OpTextFrame, Data: []byte("early")})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected [%v] found [%v]", context.DeadlineExceeded, err)
+	}
+
+	err = messages.Write(context.Background(), &websockets.Message{OpCode: websockets.OpPing, Data: []byte("hi")})
+	if err != nil {
+		t.Fatalf("Failed to ping: %v", err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+
+	err = messages.Write(context.Background(), &websockets.Message{OpCode: websockets.OpTextFrame, Data: []byte("after")})
+	if err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	messages.Close()
+
+	expected := fragment(false, false, websockets.OpBinaryFrame, payload[:64])
+	expected = append(expected, serverFrame(websockets.OpPing, "hi")...)
+	expected = append(expected, fragment(true, false, websockets.OpContinuationFrame, payload[64:])...)
+	expected = append(expected, serverFrame(websockets.OpTextFrame, "after")...)
+	if data := <-received; string(data) != string(expected) {
+		t.Errorf("Expected [%x] found [%x]", expected, data)
+	}
+}
+
+func TestStackStreamingUnsupported(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	lines := Stack(NewTcp(server, 64), adapter.NewLines(16))
+	packets := Stack(lines, adapter.NewLinePackets(nony.CodecFor("")))
+	_, _, err := packets.NextReader(context.Background())
+	if !errors.Is(err, ErrStreamingUnsupported) {
+		t.Errorf("Expected [%v] found [%v]", ErrStreamingUnsupported, err)
+	}
+}
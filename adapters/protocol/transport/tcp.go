@@ -1,32 +1,71 @@
 package transport
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"sync"
+	"time"
 )
 
+// OutboundQueueSize is how many writes may wait for the writer
+// goroutine before Write blocks.
+const OutboundQueueSize = 64
+
+const (
+	// A peer that doesn't take a write in time is dropped.
+	writeTimeout = 10 * time.Second
+	// How long Close waits for the queued writes to go out.
+	closeFlushTimeout = time.Second
+)
+
+var ErrClosed = errors.New("Connection closed")
+
+// Tcp is safe for one reader and any number of writers. Writes are
+// queued to a single writer goroutine, so each reaches the wire whole
+// and in the order it was queued.
 type Tcp struct {
 	socket     net.Conn
+	reader     *bufio.Reader
 	bufferSize int
 
-	isClosed bool
+	outbound chan []byte
+	// Held by writes while they queue, Close waits for them before
+	// closing the queue so none is queued after the last flush.
+	queueMu sync.RWMutex
+	// Closed by Close, nothing is queued from then on.
+	closing chan struct{}
+	// Closed once the writer goroutine stops, writeErr is set by then.
+	writerDone chan struct{}
+	writeErr   error
+	// Keeps the writer from extending the deadline Close shortened.
+	deadlineMu sync.Mutex
+	isFlushing bool
+	closeOnce  sync.Once
+	closeErr   error
 }
 
 func NewTcp(socket net.Conn, bufferSize int) *Tcp {
-	return &Tcp{
+	t := &Tcp{
 		socket:     socket,
+		reader:     bufio.NewReaderSize(socket, bufferSize),
 		bufferSize: bufferSize,
-		isClosed:   false,
+		outbound:   make(chan []byte, OutboundQueueSize),
+		closing:    make(chan struct{}),
+		writerDone: make(chan struct{}),
 	}
-}
 
-func (t *Tcp) Read() ([]byte, error) {
-	if t.isClosed {
-		return nil, fmt.Errorf("Connection closed")
-	}
+	go t.writeLoop()
+	return t
+}
 
+func (t *Tcp) Read(ctx context.Context) ([]byte, error) {
 	buffer := make([]byte, t.bufferSize)
-	n, err := t.socket.Read(buffer)
+	n, err := t.read(ctx, buffer)
 	if err != nil {
 		return nil, err
 	}
@@ -34,30 +73,251 @@ func (t *Tcp) Read() ([]byte, error) {
 	return buffer[:n], nil
 }
 
-func (t *Tcp) Write(data []byte) error {
-	if t.isClosed {
-		return fmt.Errorf("Connection closed")
+// Reader reads the connection under the context as a stream, for
+// layers streaming what they read rather than taking it in chunks.
+func (t *Tcp) Reader(ctx context.Context) io.Reader {
+	return &contextReader{ctx: ctx, tcp: t}
+}
+
+type contextReader struct {
+	ctx context.Context
+	tcp *Tcp
+}
+
+func (c *contextReader) Read(buffer []byte) (int, error) {
+	return c.tcp.read(c.ctx, buffer)
+}
+
+func (t *Tcp) read(ctx context.Context, buffer []byte) (int, error) {
+	if t.isClosed() {
+		return 0, ErrClosed
+	}
+
+	n := 0
+	err := withContext(ctx, t.socket.SetReadDeadline, func() error {
+		var err error
+		n, err = t.reader.Read(buffer)
+		return err
+	})
+
+	return n, err
+}
+
+// Peek waits for data and returns the bytes buffered so far without
+// consuming them, they're consumed by Discard. It lets a parser take
+// just what it needs and leave the rest to the next layer.
+func (t *Tcp) Peek(ctx context.Context) ([]byte, error) {
+	if t.isClosed() {
+		return nil, ErrClosed
+	}
+
+	err := withContext(ctx, t.socket.SetReadDeadline, func() error {
+		_, err := t.reader.Peek(1)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return t.reader.Peek(t.reader.Buffered())
+}
+
+func (t *Tcp) Discard(n int) error {
+	_, err := t.reader.Discard(n)
+	return err
+}
+
+func (t *Tcp) RemoteAddr() net.Addr {
+	return t.socket.RemoteAddr()
+}
+
+// Write queues the data for the writer goroutine, blocking while the
+// queue is full. The data must not be changed once queued. An error
+// writing earlier data fails the connection and is returned by the
+// writes that follow.
+func (t *Tcp) Write(ctx context.Context, data []byte) error {
+	t.queueMu.RLock()
+	defer t.queueMu.RUnlock()
+
+	if t.isClosed() {
+		return ErrClosed
+	}
+
+	select {
+	case <-t.writerDone:
+		return t.writeFailure()
+	default:
 	}
 
+	select {
+	case t.outbound <- data:
+		return nil
+	case <-t.writerDone:
+		return t.writeFailure()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Tcp) writeFailure() error {
+	if t.writeErr != nil {
+		return fmt.Errorf("failed to write: %w", t.writeErr)
+	}
+
+	return ErrClosed
+}
+
+// writeLoop is the only writer of the socket.
+func (t *Tcp) writeLoop() {
+	defer close(t.writerDone)
+
+	for {
+		select {
+		case data := <-t.outbound:
+			t.extendWriteDeadline()
+			t.writeErr = t.write(data)
+			if t.writeErr != nil {
+				// The reader is woken up as well.
+				t.socket.Close()
+				return
+			}
+		case <-t.closing:
+			// Queued writes, e.g. a close frame, get a last chance
+			// to go out under the deadline set by Close.
+			for {
+				select {
+				case data := <-t.outbound:
+					if t.write(data) != nil {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *Tcp) write(data []byte) error {
 	n, err := t.socket.Write(data)
 	if err != nil {
-		return fmt.Errorf("failed to write handshake: %w", err)
+		return err
 	}
 
 	if n != len(data) {
-		return fmt.Errorf("response not fully written, expected: %d, actual: %d", len(data), n)
+		return fmt.Errorf("data not fully written, expected: %d, actual: %d", len(data), n)
 	}
 
 	return nil
 }
 
+func (t *Tcp) extendWriteDeadline() {
+	t.deadlineMu.Lock()
+	defer t.deadlineMu.Unlock()
+
+	if !t.isFlushing {
+		t.socket.SetWriteDeadline(time.Now().Add(writeTimeout))
+	}
+}
+
+func (t *Tcp) isClosed() bool {
+	select {
+	case <-t.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close flushes the queued writes, for a while, then closes the socket.
+// It's safe to call from any goroutine, any number of times.
 func (t *Tcp) Close() error {
-	if t.isClosed {
-		return nil
+	t.closeOnce.Do(func() {
+		// Writes blocked on a full queue are only waited for
+		// until the flush deadline.
+		t.deadlineMu.Lock()
+		t.isFlushing = true
+		t.socket.SetWriteDeadline(time.Now().Add(closeFlushTimeout))
+		t.deadlineMu.Unlock()
+
+		t.queueMu.Lock()
+		close(t.closing)
+		t.queueMu.Unlock()
+
+		<-t.writerDone
+		t.closeErr = t.socket.Close()
+		if errors.Is(t.closeErr, net.ErrClosed) {
+			// The writer closed it after failing.
+			t.closeErr = nil
+		}
+	})
+
+	return t.closeErr
+}
+
+// withContext runs a blocking socket operation under the context. The
+// context's deadline becomes the socket's and cancelling the context
+// moves the deadline to the past, which interrupts the operation. The
+// context's error is returned in place of the socket's timeout.
+func withContext(ctx context.Context, setDeadline func(time.Time) error, operation func() error) error {
+	// Background contexts can't be cancelled, leave the deadline alone.
+	if ctx.Done() == nil {
+		return operation()
+	}
+
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	deadline, _ := ctx.Deadline()
+	setDeadline(deadline)
+
+	interrupted := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		setDeadline(time.Unix(1, 0))
+		close(interrupted)
+	})
+
+	err = operation()
+
+	// Clearing the deadline must come after the interruption, if
+	// one is under way, or the next operation would time out.
+	if !stop() {
+		<-interrupted
 	}
+	setDeadline(time.Time{})
 
-	err := t.socket.Close()
-	t.isClosed = true
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		// The socket may time out a hair before the context does.
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return context.DeadlineExceeded
+	}
 
 	return err
 }
+
+// isContextErr tells if an operation stopped because its context
+// is done, the connection itself is still usable then.
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// withTimeout bounds the context by the timeout, unless it's zero. It
+// tells if the timeout ends up being the earliest deadline, so that
+// expiring is the timeout's doing rather than the caller's. The socket
+// may time out a hair before the context does, which is why that isn't
+// told by ctx.Err().
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc, bool) {
+	if timeout <= 0 {
+		return ctx, func() {}, false
+	}
+
+	parentDeadline, hasDeadline := ctx.Deadline()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	deadline, _ := ctx.Deadline()
+
+	return ctx, cancel, !hasDeadline || deadline.Before(parentDeadline)
+}
@@ -0,0 +1,211 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTcpReadContext(t *testing.T) {
+	cases := []struct {
+		description string
+		makeContext func() (context.Context, context.CancelFunc)
+		expected    error
+	}{
+		{
+			description: "cancelled while blocked",
+			makeContext: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(20*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			expected: context.Canceled,
+		},
+		{
+			description: "deadline passed while blocked",
+			makeContext: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 20*time.Millisecond)
+			},
+			expected: context.DeadlineExceeded,
+		},
+		{
+			description: "cancelled before reading",
+			makeContext: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			expected: context.Canceled,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+
+			tcpTransport := NewTcp(server, 64)
+			defer tcpTransport.Close()
+
+			ctx, cancel := c.makeContext()
+			defer cancel()
+
+			_, err := tcpTransport.Read(ctx)
+			if !errors.Is(err, c.expected) {
+				t.Errorf("Expected [%v] found [%v]", c.expected, err)
+			}
+
+			// The connection is still usable, without a stale deadline.
+			go client.Write([]byte("hello"))
+			data, err := tcpTransport.Read(context.Background())
+			if err != nil || string(data) != "hello" {
+				t.Errorf("Expected [hello] after the interruption found [%s] %v", data, err)
+			}
+		})
+	}
+}
+
+func TestTcpWriteContext(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	tcpTransport := NewTcp(server, 64)
+	defer tcpTransport.Close()
+
+	// Nobody reads the other end, writes block once the queue is full.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	var err error
+	for i := 0; i <= OutboundQueueSize+1 && err == nil; i++ {
+		err = tcpTransport.Write(ctx, []byte("hello"))
+	}
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected [%v] found [%v]", context.DeadlineExceeded, err)
+	}
+}
+
+func TestTcpConcurrentWrites(t *testing.T) {
+	server, client := net.Pipe()
+
+	tcpTransport := NewTcp(server, 64)
+
+	// Every writer sends its own sequence, each write has to arrive
+	// whole and in order relative to the writer's other writes.
+	writers, writes := 8, 50
+	done := sync.WaitGroup{}
+	for writer := 0; writer < writers; writer++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			for i := 0; i < writes; i++ {
+				tcpTransport.Write(context.Background(), []byte(fmt.Sprintf("[%d:%03d]", writer, i)))
+			}
+		}()
+	}
+
+	go func() {
+		done.Wait()
+		tcpTransport.Close()
+	}()
+
+	received, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+
+	next := make([]int, writers)
+	for _, write := range strings.SplitAfter(string(received), "]") {
+		if write == "" {
+			continue
+		}
+
+		var writer, i int
+		_, err := fmt.Sscanf(write, "[%d:%d]", &writer, &i)
+		if err != nil || i != next[writer] {
+			t.Fatalf("Expected write [%d] of writer [%d] found [%s]", next[writer], writer, write)
+		}
+		next[writer]++
+	}
+
+	for writer, count := range next {
+		if count != writes {
+			t.Errorf("Expected [%d] writes from writer [%d] found [%d]", writes, writer, count)
+		}
+	}
+}
+
+func TestTcpConcurrentClose(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	go io.Copy(io.Discard, client)
+
+	tcpTransport := NewTcp(server, 64)
+
+	done := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		done.Add(2)
+		go func() {
+			defer done.Done()
+			tcpTransport.Write(context.Background(), []byte("hello"))
+		}()
+		go func() {
+			defer done.Done()
+			tcpTransport.Close()
+		}()
+	}
+	done.Wait()
+
+	err := tcpTransport.Write(context.Background(), []byte("hello"))
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected [%v] found [%v]", ErrClosed, err)
+	}
+
+	_, err = tcpTransport.Read(context.Background())
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected [%v] found [%v]", ErrClosed, err)
+	}
+}
+
+func TestTcpWriteRacingClose(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		server, client := net.Pipe()
+		received := make(chan []byte)
+		go func() {
+			data, _ := io.ReadAll(client)
+			received <- data
+		}()
+
+		tcpTransport := NewTcp(server, 64)
+
+		// Every write that's accepted reaches the peer.
+		queued := atomic.Int64{}
+		done := sync.WaitGroup{}
+		for j := 0; j < 8; j++ {
+			done.Add(1)
+			go func() {
+				defer done.Done()
+				err := tcpTransport.Write(context.Background(), []byte("x"))
+				if err == nil {
+					queued.Add(1)
+				} else if !errors.Is(err, ErrClosed) {
+					t.Errorf("Expected [%v] found [%v]", ErrClosed, err)
+				}
+			}()
+		}
+		tcpTransport.Close()
+		done.Wait()
+
+		if data := <-received; int64(len(data)) != queued.Load() {
+			t.Fatalf("Expected [%d] queued writes to be sent found [%d]", queued.Load(), len(data))
+		}
+	}
+}
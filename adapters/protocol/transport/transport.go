@@ -1,7 +1,12 @@
 package transport
 
+import "context"
+
+// Transport reads and writes one kind of unit. Cancelling the context
+// interrupts a blocked Read or Write, which then returns the context's
+// error.
 type Transport[T any] interface {
-	Read() (p T, err error)
-	Write(p T) (err error)
+	Read(ctx context.Context) (p T, err error)
+	Write(ctx context.Context, p T) (err error)
 	Close() error
 }
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP resolves the client behind trusted proxies from the
+// Forwarded or X-Forwarded-For headers. The hops are walked from the
+// nearest one and the first untrusted address is the client, since
+// clients can put anything at the start of the list.
+// https://datatracker.ietf.org/doc/html/rfc7239
+func ClientIP(peer net.IP, header http.Header, trusted TrustedProxies) net.IP {
+	if !trusted.Contains(peer) {
+		return peer
+	}
+
+	hops := forwardedHops(header.Values("Forwarded"))
+	if len(hops) == 0 {
+		hops = forwardedForHops(header.Values("X-Forwarded-For"))
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := hops[i]
+		// An obfuscated or unknown hop ends the trusted chain.
+		if ip == nil {
+			break
+		}
+
+		client = ip
+		if !trusted.Contains(ip) {
+			break
+		}
+	}
+
+	return client
+}
+
+// Forwarded: for=192.0.2.60;proto=http, for="[2001:db8:cafe::17]:4711"
+func forwardedHops(values []string) []net.IP {
+	hops := []net.IP{}
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			var hop net.IP
+			for _, pair := range strings.Split(element, ";") {
+				name, nodeValue, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "for") {
+					hop = parseNode(strings.Trim(nodeValue, `"`))
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+
+	return hops
+}
+
+// X-Forwarded-For: 203.0.113.195, 70.41.3.18
+func forwardedForHops(values []string) []net.IP {
+	hops := []net.IP{}
+	for _, value := range values {
+		for _, node := range strings.Split(value, ",") {
+			hops = append(hops, parseNode(strings.TrimSpace(node)))
+		}
+	}
+
+	return hops
+}
+
+// parseNode accepts an IP, optionally bracketed or with a port.
+func parseNode(node string) net.IP {
+	host, _, err := net.SplitHostPort(node)
+	if err != nil {
+		host = node
+	}
+
+	return net.ParseIP(strings.Trim(host, "[]"))
+}
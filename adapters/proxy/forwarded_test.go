@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "2001:db8::1"})
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	cases := []struct {
+		description string
+		peer        string
+		header      http.Header
+		client      string
+	}{
+		{
+			description: "Untrusted peer's headers are ignored",
+			peer:        "203.0.113.7",
+			header:      http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			client:      "203.0.113.7",
+		},
+		{
+			description: "Trusted peer without headers",
+			peer:        "10.0.0.1",
+			header:      http.Header{},
+			client:      "10.0.0.1",
+		},
+		{
+			description: "X-Forwarded-For",
+			peer:        "10.0.0.1",
+			header:      http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			client:      "198.51.100.1",
+		},
+		{
+			description: "Spoofed entries before the client are skipped",
+			peer:        "10.0.0.1",
+			header:      http.Header{"X-Forwarded-For": {"1.2.3.4, 198.51.100.1", "10.0.0.2"}},
+			client:      "198.51.100.1",
+		},
+		{
+			description: "Forwarded wins over X-Forwarded-For",
+			peer:        "2001:db8::1",
+			header: http.Header{
+				"Forwarded":       {`for=1.2.3.4, for="[2001:db8:cafe::17]:4711";proto=https`},
+				"X-Forwarded-For": {"198.51.100.1"},
+			},
+			client: "2001:db8:cafe::17",
+		},
+		{
+			description: "Obfuscated hop",
+			peer:        "10.0.0.1",
+			header:      http.Header{"Forwarded": {"for=198.51.100.1, for=_hidden"}},
+			client:      "10.0.0.1",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			client := ClientIP(net.ParseIP(c.peer), c.header, trusted)
+			if !client.Equal(net.ParseIP(c.client)) {
+				t.Errorf("Expected client %s, got: %s", c.client, client)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	_, err := ParseTrustedProxies([]string{"10.0.0.0/33"})
+	if err == nil {
+		t.Errorf("Expected invalid CIDR to fail")
+	}
+
+	_, err = ParseTrustedProxies([]string{"proxy.local"})
+	if err == nil {
+		t.Errorf("Expected host names to fail")
+	}
+}
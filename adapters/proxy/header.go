@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidHeader = errors.New("Invalid PROXY protocol header")
+
+// https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	v1Prefix = "PROXY "
+	// The longest v1 line, CRLF included.
+	v1MaxLength = 107
+	// Bounds the TLVs following the v2 addresses.
+	v2MaxLength = 4096
+
+	v2CommandLocal = 0x0
+	v2CommandProxy = 0x1
+
+	v2FamilyInet  = 0x1
+	v2FamilyInet6 = 0x2
+	v2Stream      = 0x1
+)
+
+// Header is a parsed PROXY protocol header, addresses are nil when the
+// proxy didn't relay a client, e.g. for its own health checks.
+type Header struct {
+	Version     int
+	Source      *net.TCPAddr
+	Destination *net.TCPAddr
+}
+
+// HasHeader peeks at the reader for a PROXY protocol signature.
+func HasHeader(reader *bufio.Reader) (bool, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return false, err
+	}
+
+	switch first[0] {
+	case v1Prefix[0]:
+		prefix, err := reader.Peek(len(v1Prefix))
+		return err == nil && string(prefix) == v1Prefix, err
+	case v2Signature[0]:
+		signature, err := reader.Peek(len(v2Signature))
+		return err == nil && bytes.Equal(signature, v2Signature), err
+	}
+
+	return false, nil
+}
+
+// ReadHeader reads a v1 or v2 header, HasHeader tells if there's one.
+func ReadHeader(reader *bufio.Reader) (Header, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return Header{}, err
+	}
+
+	if first[0] == v1Prefix[0] {
+		return readV1(reader)
+	}
+
+	return readV2(reader)
+}
+
+// PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n
+func readV1(reader *bufio.Reader) (Header, error) {
+	line := make([]byte, 0, v1MaxLength)
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) == v1MaxLength {
+			return Header{}, fmt.Errorf("%w: line too long", ErrInvalidHeader)
+		}
+
+		b, err := reader.ReadByte()
+		if err != nil {
+			return Header{}, err
+		}
+		line = append(line, b)
+	}
+
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return Header{}, fmt.Errorf("%w: %q", ErrInvalidHeader, line)
+	}
+
+	if fields[1] == "UNKNOWN" {
+		return Header{Version: 1}, nil
+	}
+
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return Header{}, fmt.Errorf("%w: %q", ErrInvalidHeader, line)
+	}
+
+	source, err := parseV1Addr(fields[2], fields[4], fields[1] == "TCP4")
+	if err != nil {
+		return Header{}, err
+	}
+
+	destination, err := parseV1Addr(fields[3], fields[5], fields[1] == "TCP4")
+	if err != nil {
+		return Header{}, err
+	}
+
+	return Header{Version: 1, Source: source, Destination: destination}, nil
+}
+
+func parseV1Addr(host string, port string, isV4 bool) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil || (ip.To4() != nil) != isV4 {
+		return nil, fmt.Errorf("%w: invalid address %s", ErrInvalidHeader, host)
+	}
+
+	portNumber, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid port %s", ErrInvalidHeader, port)
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(portNumber)}, nil
+}
+
+func readV2(reader *bufio.Reader) (Header, error) {
+	fixed := make([]byte, 16)
+	_, err := io.ReadFull(reader, fixed)
+	if err != nil {
+		return Header{}, err
+	}
+
+	if !bytes.Equal(fixed[:12], v2Signature) || fixed[12]>>4 != 2 {
+		return Header{}, fmt.Errorf("%w: bad signature", ErrInvalidHeader)
+	}
+
+	length := int(binary.BigEndian.Uint16(fixed[14:16]))
+	if length > v2MaxLength {
+		return Header{}, fmt.Errorf("%w: header too long", ErrInvalidHeader)
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(reader, payload)
+	if err != nil {
+		return Header{}, err
+	}
+
+	command := fixed[12] & 0x0F
+	family, transport := fixed[13]>>4, fixed[13]&0x0F
+	switch {
+	case command == v2CommandLocal:
+		return Header{Version: 2}, nil
+	case command != v2CommandProxy:
+		return Header{}, fmt.Errorf("%w: unknown command %d", ErrInvalidHeader, command)
+	case transport != v2Stream:
+		// Only TCP is relayed, other transports keep the proxy's address.
+		return Header{Version: 2}, nil
+	}
+
+	addressLength := 0
+	switch family {
+	case v2FamilyInet:
+		addressLength = net.IPv4len
+	case v2FamilyInet6:
+		addressLength = net.IPv6len
+	default:
+		return Header{Version: 2}, nil
+	}
+
+	if len(payload) < 2*addressLength+4 {
+		return Header{}, fmt.Errorf("%w: short address block", ErrInvalidHeader)
+	}
+
+	ports := payload[2*addressLength:]
+	return Header{
+		Version: 2,
+		Source: &net.TCPAddr{
+			IP:   net.IP(payload[:addressLength]),
+			Port: int(binary.BigEndian.Uint16(ports[0:2])),
+		},
+		Destination: &net.TCPAddr{
+			IP:   net.IP(payload[addressLength : 2*addressLength]),
+			Port: int(binary.BigEndian.Uint16(ports[2:4])),
+		},
+	}, nil
+}
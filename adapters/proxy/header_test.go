@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func v2Header(command byte, family byte, addresses ...byte) string {
+	header := string(v2Signature) + string([]byte{0x20 | command, family, 0, byte(len(addresses))})
+	return header + string(addresses)
+}
+
+func TestReadHeader(t *testing.T) {
+	cases := []struct {
+		description string
+		input       string
+		source      string
+		destination string
+		fails       bool
+	}{
+		{
+			description: "v1 TCP4",
+			input:       "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n",
+			source:      "192.168.0.1:56324",
+			destination: "192.168.0.11:443",
+		},
+		{
+			description: "v1 TCP6",
+			input:       "PROXY TCP6 2001:db8::1 2001:db8::2 4711 443\r\n",
+			source:      "[2001:db8::1]:4711",
+			destination: "[2001:db8::2]:443",
+		},
+		{
+			description: "v1 UNKNOWN",
+			input:       "PROXY UNKNOWN\r\n",
+		},
+		{
+			description: "v1 family mismatch",
+			input:       "PROXY TCP4 2001:db8::1 2001:db8::2 4711 443\r\n",
+			fails:       true,
+		},
+		{
+			description: "v1 bad port",
+			input:       "PROXY TCP4 192.168.0.1 192.168.0.11 70000 443\r\n",
+			fails:       true,
+		},
+		{
+			description: "v1 too long",
+			input:       "PROXY TCP4 " + strings.Repeat("1", 200) + "\r\n",
+			fails:       true,
+		},
+		{
+			description: "v1 truncated",
+			input:       "PROXY TCP4 192.168.0.1",
+			fails:       true,
+		},
+		{
+			description: "v2 TCP over IPv4",
+			input:       v2Header(v2CommandProxy, 0x11, 10, 0, 0, 1, 10, 0, 0, 2, 0x1F, 0x90, 0x01, 0xBB),
+			source:      "10.0.0.1:8080",
+			destination: "10.0.0.2:443",
+		},
+		{
+			description: "v2 TCP over IPv6",
+			input: v2Header(v2CommandProxy, 0x21,
+				0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1,
+				0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2,
+				0x12, 0x67, 0x01, 0xBB),
+			source:      "[2001:db8::1]:4711",
+			destination: "[2001:db8::2]:443",
+		},
+		{
+			description: "v2 with TLVs",
+			input:       v2Header(v2CommandProxy, 0x11, 10, 0, 0, 1, 10, 0, 0, 2, 0x1F, 0x90, 0x01, 0xBB, 0x04, 0x00, 0x01, 0x00),
+			source:      "10.0.0.1:8080",
+			destination: "10.0.0.2:443",
+		},
+		{
+			description: "v2 LOCAL",
+			input:       v2Header(v2CommandLocal, 0x00),
+		},
+		{
+			description: "v2 short addresses",
+			input:       v2Header(v2CommandProxy, 0x11, 10, 0, 0, 1),
+			fails:       true,
+		},
+		{
+			description: "v2 unknown command",
+			input:       v2Header(0x5, 0x11, 10, 0, 0, 1, 10, 0, 0, 2, 0x1F, 0x90, 0x01, 0xBB),
+			fails:       true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(c.input + "GET / HTTP/1.1\r\n"))
+			hasHeader, err := HasHeader(reader)
+			if err != nil || !hasHeader {
+				t.Fatalf("Expected a header, got: %t %v", hasHeader, err)
+			}
+
+			header, err := ReadHeader(reader)
+			if c.fails {
+				if err == nil {
+					t.Errorf("Expected error for %q", c.input)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if addrString(header.Source) != c.source || addrString(header.Destination) != c.destination {
+				t.Errorf("Expected %s -> %s, got: %s -> %s", c.source, c.destination, header.Source, header.Destination)
+			}
+
+			rest, _ := io.ReadAll(reader)
+			if string(rest) != "GET / HTTP/1.1\r\n" {
+				t.Errorf("Expected the request to follow the header, got: %q", rest)
+			}
+		})
+	}
+}
+
+func TestHasHeader(t *testing.T) {
+	for _, input := range []string{"GET / HTTP/1.1\r\n", "PROXX", "\r\n\r\n"} {
+		hasHeader, err := HasHeader(bufio.NewReader(strings.NewReader(input)))
+		if hasHeader || (err != nil && !errors.Is(err, io.EOF)) {
+			t.Errorf("Unexpected header in %q: %v", input, err)
+		}
+	}
+}
+
+func addrString(addr *net.TCPAddr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
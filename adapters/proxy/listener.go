@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"bufio"
+	"net"
+	"sync"
+)
+
+// Listener reads PROXY protocol headers sent by trusted proxies, the
+// connections it accepts report the relayed client as RemoteAddr.
+type Listener struct {
+	net.Listener
+	trusted TrustedProxies
+}
+
+func NewListener(listener net.Listener, trusted TrustedProxies) *Listener {
+	return &Listener{
+		Listener: listener,
+		trusted:  trusted,
+	}
+}
+
+// Accept doesn't wait for the header, it's read by the first Read or
+// RemoteAddr call so a slow proxy can't stall the accept loop. The
+// header is read under the connection's read deadline, if any.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{
+		Conn:      conn,
+		reader:    bufio.NewReader(conn),
+		isTrusted: l.trusted.Contains(ipOf(conn.RemoteAddr())),
+	}, nil
+}
+
+type Conn struct {
+	net.Conn
+	reader    *bufio.Reader
+	isTrusted bool
+
+	headerOnce sync.Once
+	header     Header
+	headerErr  error
+}
+
+func (c *Conn) Read(buffer []byte) (int, error) {
+	c.readHeader()
+	if c.headerErr != nil {
+		return 0, c.headerErr
+	}
+
+	return c.reader.Read(buffer)
+}
+
+// RemoteAddr is the client relayed by a trusted proxy,
+// or the peer's address without a header.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.header.Source != nil {
+		return c.header.Source
+	}
+
+	return c.Conn.RemoteAddr()
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	c.readHeader()
+	if c.header.Destination != nil {
+		return c.header.Destination
+	}
+
+	return c.Conn.LocalAddr()
+}
+
+// Header is the parsed PROXY header, empty if there was none.
+func (c *Conn) Header() (Header, error) {
+	c.readHeader()
+	return c.header, c.headerErr
+}
+
+// readHeader only trusts headers from trusted peers, anyone else
+// could claim to be any client.
+func (c *Conn) readHeader() {
+	c.headerOnce.Do(func() {
+		if !c.isTrusted {
+			return
+		}
+
+		hasHeader, err := HasHeader(c.reader)
+		if err != nil || !hasHeader {
+			return
+		}
+
+		c.header, c.headerErr = ReadHeader(c.reader)
+		if c.headerErr != nil {
+			c.Conn.Close()
+		}
+	})
+}
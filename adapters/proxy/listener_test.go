@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"testing"
+)
+
+func acceptWith(t *testing.T, trusted []string, input string) (net.Conn, string) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { inner.Close() })
+
+	trustedProxies, err := ParseTrustedProxies(trusted)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	listener := NewListener(inner, trustedProxies)
+
+	client, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	client.Write([]byte(input))
+	client.(*net.TCPConn).CloseWrite()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	received, _ := io.ReadAll(conn)
+	return conn, string(received)
+}
+
+func TestListener(t *testing.T) {
+	header := "PROXY TCP4 198.51.100.1 10.0.0.2 4711 443\r\n"
+	request := "GET / HTTP/1.1\r\n\r\n"
+
+	t.Run("Trusted proxy", func(t *testing.T) {
+		conn, received := acceptWith(t, []string{"127.0.0.1"}, header+request)
+		if conn.RemoteAddr().String() != "198.51.100.1:4711" {
+			t.Errorf("Expected the relayed client, got: %s", conn.RemoteAddr())
+		}
+
+		if received != request {
+			t.Errorf("Expected the header to be stripped, got: %q", received)
+		}
+	})
+
+	t.Run("Trusted proxy without a header", func(t *testing.T) {
+		conn, received := acceptWith(t, []string{"127.0.0.1"}, request)
+		if conn.RemoteAddr().(*net.TCPAddr).IP.String() != "127.0.0.1" || received != request {
+			t.Errorf("Expected a plain connection, got: %s %q", conn.RemoteAddr(), received)
+		}
+	})
+
+	t.Run("Untrusted peer", func(t *testing.T) {
+		conn, received := acceptWith(t, []string{"10.0.0.0/8"}, header+request)
+		if conn.RemoteAddr().(*net.TCPAddr).IP.String() != "127.0.0.1" {
+			t.Errorf("Expected the spoofed header to be ignored, got: %s", conn.RemoteAddr())
+		}
+
+		if received != header+request {
+			t.Errorf("Expected the header to be passed through, got: %q", received)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// TrustedProxies are the networks of load balancers allowed to tell the
+// server who the client is, anything else could spoof its address.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses CIDRs or single IPs, e.g. "10.0.0.0/8".
+func ParseTrustedProxies(values []string) (TrustedProxies, error) {
+	trusted := TrustedProxies{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %s", value)
+			}
+
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			trusted = append(trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %w", err)
+		}
+		trusted = append(trusted, network)
+	}
+
+	return trusted, nil
+}
+
+func (t TrustedProxies) Contains(ip net.IP) bool {
+	for _, network := range t {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ipOf extracts the IP of a TCP address, nil for other addresses.
+func ipOf(addr net.Addr) net.IP {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return nil
+	}
+
+	return tcpAddr.IP
+}
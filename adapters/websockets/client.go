@@ -0,0 +1,356 @@
+package websockets
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var ErrBadHandshake = errors.New("Bad websocket handshake response")
+
+// How long Close waits for the server to echo the close frame.
+const closeHandshakeTimeout = 5 * time.Second
+
+// Dialer holds the options used to open client connections.
+type Dialer struct {
+	BufferSize     int
+	MaxMessageSize uint64
+	// Offer permessage-deflate in the handshake.
+	EnableCompression bool
+	// Subprotocols offered to the server, most preferred first.
+	Subprotocols []string
+	// Extra headers sent with the handshake request, e.g. Origin.
+	Header http.Header
+	// Used to dial wss:// URLs, the server name defaults to the
+	// URL's host.
+	TLSConfig *tls.Config
+}
+
+var DefaultDialer = &Dialer{
+	BufferSize:     2048,
+	MaxMessageSize: DefaultMaxPayloadLength,
+}
+
+// Client is the client side of a websocket connection. It shares the
+// frame reader, encoder and message assembler with the server.
+type Client struct {
+	conn        net.Conn
+	frameReader *FrameReader
+	assembler   *MessageAssembler
+	deflate     *Deflate
+	protocol    string
+
+	isCloseSent bool
+}
+
+// Dial connects to a ws:// or wss:// URL using the DefaultDialer.
+func Dial(rawURL string) (*Client, error) {
+	return DefaultDialer.Dial(rawURL)
+}
+
+func (d *Dialer) Dial(rawURL string) (*Client, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := d.dial(target)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := d.handshake(conn, target)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// https://datatracker.ietf.org/doc/html/rfc6455#section-3
+func (d *Dialer) dial(target *url.URL) (net.Conn, error) {
+	switch target.Scheme {
+	case "ws":
+		return net.Dial("tcp", hostPort(target, "80"))
+	case "wss":
+		config := &tls.Config{}
+		if d.TLSConfig != nil {
+			config = d.TLSConfig.Clone()
+		}
+
+		if config.ServerName == "" {
+			config.ServerName = target.Hostname()
+		}
+
+		return tls.Dial("tcp", hostPort(target, "443"), config)
+	}
+
+	return nil, fmt.Errorf("Unsupported URL scheme: %s", target.Scheme)
+}
+
+func hostPort(target *url.URL, defaultPort string) string {
+	if target.Port() == "" {
+		return net.JoinHostPort(target.Hostname(), defaultPort)
+	}
+
+	return target.Host
+}
+
+// https://datatracker.ietf.org/doc/html/rfc6455#section-4.1
+func (d *Dialer) handshake(conn net.Conn, target *url.URL) (*Client, error) {
+	key, err := makeWebsocketKey()
+	if err != nil {
+		return nil, err
+	}
+
+	request := ""
+	request += "GET " + target.RequestURI() + " HTTP/1.1" + "\r\n"
+	request += "Host: " + target.Host + "\r\n"
+	request += "Upgrade: websocket" + "\r\n"
+	request += "Connection: Upgrade" + "\r\n"
+	request += "Sec-WebSocket-Key: " + key + "\r\n"
+	request += "Sec-WebSocket-Version: 13" + "\r\n"
+	if d.EnableCompression {
+		request += "Sec-WebSocket-Extensions: " + PerMessageDeflate + "\r\n"
+	}
+	if len(d.Subprotocols) > 0 {
+		request += "Sec-WebSocket-Protocol: " + strings.Join(d.Subprotocols, ", ") + "\r\n"
+	}
+	for name, values := range d.Header {
+		for _, value := range values {
+			request += name + ": " + value + "\r\n"
+		}
+	}
+	request += "\r\n"
+
+	_, err = conn.Write([]byte(request))
+	if err != nil {
+		return nil, err
+	}
+
+	// Frames may follow the response right away, the same
+	// buffered reader is kept to read them.
+	reader := bufio.NewReaderSize(conn, d.BufferSize)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadHandshake, err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("%w: status %s", ErrBadHandshake, response.Status)
+	}
+
+	if !strings.EqualFold(response.Header.Get("Upgrade"), "websocket") {
+		return nil, fmt.Errorf("%w: missing Upgrade header", ErrBadHandshake)
+	}
+
+	if !hasToken(response.Header.Get("Connection"), "upgrade") {
+		return nil, fmt.Errorf("%w: missing Connection header", ErrBadHandshake)
+	}
+
+	if response.Header.Get("Sec-WebSocket-Accept") != ComputeAcceptKey(key) {
+		return nil, fmt.Errorf("%w: Sec-WebSocket-Accept mismatch", ErrBadHandshake)
+	}
+
+	// The server must pick one of the offered subprotocols, if any.
+	protocol := response.Header.Get("Sec-WebSocket-Protocol")
+	if protocol != "" {
+		_, isOffered := NegotiateProtocol([]string{protocol}, d.Subprotocols)
+		if !isOffered {
+			return nil, fmt.Errorf("%w: unexpected subprotocol %s", ErrBadHandshake, protocol)
+		}
+	}
+
+	frameReader := NewFrameReader(reader, d.BufferSize)
+	frameReader.SetMaxPayloadLength(d.MaxMessageSize)
+	frameReader.isFromClient = false
+
+	client := &Client{
+		conn:        conn,
+		frameReader: frameReader,
+		assembler:   NewMessageAssembler(d.MaxMessageSize),
+		protocol:    protocol,
+		isCloseSent: false,
+	}
+
+	// The server must not use an extension the client didn't offer.
+	extensions := ParseExtensions(strings.Join(response.Header.Values("Sec-WebSocket-Extensions"), ","))
+	if len(extensions) > 1 || (len(extensions) == 1 && !d.EnableCompression) {
+		return nil, fmt.Errorf("%w: unexpected extensions", ErrBadHandshake)
+	}
+
+	if len(extensions) == 1 {
+		params, ok := parseDeflateResponse(extensions[0])
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid %s response", ErrBadHandshake, PerMessageDeflate)
+		}
+
+		client.deflate = NewClientDeflate(params)
+		frameReader.EnableCompression()
+		client.assembler.EnableCompression(client.deflate)
+	}
+
+	return client, nil
+}
+
+// The value of this header field MUST be a nonce consisting of a randomly
+// selected 16-byte value that has been base64-encoded.
+func makeWebsocketKey() (string, error) {
+	nonce := make([]uint8, 16)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(nonce), nil
+}
+
+func hasToken(header string, token string) bool {
+	for _, value := range strings.Split(header, ",") {
+		if strings.EqualFold(strings.TrimSpace(value), token) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Subprotocol is the one the server chose, empty if it chose none.
+func (c *Client) Subprotocol() string {
+	return c.protocol
+}
+
+// ReadMessage blocks until a whole data message arrives. Pings are
+// answered and pongs are dropped. Once the server closes the connection
+// the close handshake is completed and a *CloseError is returned.
+func (c *Client) ReadMessage() (*Message, error) {
+	for {
+		message, err := c.readMessage()
+		if err != nil {
+			return nil, err
+		}
+
+		switch message.OpCode {
+		case OpPing:
+			err = c.WriteMessage(&Message{OpCode: OpPong, Data: message.Data})
+			if err != nil {
+				c.conn.Close()
+				return nil, err
+			}
+		case OpPong:
+		case OpConnectionClose:
+			closeErr, err := ParseCloseMessage(message.Data)
+			if err != nil {
+				c.fail(err)
+				return nil, err
+			}
+
+			if !c.isCloseSent {
+				c.isCloseSent = true
+				c.WriteMessage(NewCloseMessage(closeErr.Code, ""))
+			}
+			c.conn.Close()
+			return nil, closeErr
+		default:
+			return message, nil
+		}
+	}
+}
+
+func (c *Client) readMessage() (*Message, error) {
+	for {
+		frame, err := c.frameReader.ReadFrame()
+		if err != nil {
+			c.fail(err)
+			return nil, err
+		}
+
+		message, err := c.assembler.Push(frame)
+		if err != nil {
+			c.fail(err)
+			return nil, err
+		}
+
+		if message != nil {
+			return message, nil
+		}
+	}
+}
+
+// WriteMessage sends the message in a single masked frame.
+func (c *Client) WriteMessage(message *Message) error {
+	frame := NewFrame(message.OpCode, message.Data)
+	if c.deflate != nil && !frame.IsControl() {
+		compressed, err := c.deflate.CompressFrame(frame)
+		if err != nil {
+			return err
+		}
+		frame = compressed
+	}
+
+	mask := [4]uint8{}
+	_, err := rand.Read(mask[:])
+	if err != nil {
+		return err
+	}
+	frame.setMask(mask)
+
+	_, err = c.conn.Write(frame.Encode())
+	return err
+}
+
+func (c *Client) WriteText(text string) error {
+	return c.WriteMessage(&Message{OpCode: OpTextFrame, Data: []uint8(text)})
+}
+
+// CloseWithCode starts the close handshake and waits a bit for the server
+// to echo it. Data messages received meanwhile are dropped.
+// https://datatracker.ietf.org/doc/html/rfc6455#section-7.1.1
+// The underlying TCP connection, in most normal cases, SHOULD be closed
+// first by the server.
+func (c *Client) CloseWithCode(code CloseCode, reason string) error {
+	if c.isCloseSent {
+		return c.conn.Close()
+	}
+
+	c.isCloseSent = true
+	err := c.WriteMessage(NewCloseMessage(code, reason))
+	if err != nil {
+		return c.conn.Close()
+	}
+
+	// Reading stops on the echoed close frame, or on a timeout. Either
+	// way the connection is closed by then.
+	c.conn.SetReadDeadline(time.Now().Add(closeHandshakeTimeout))
+	for {
+		_, err := c.ReadMessage()
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+func (c *Client) Close() error {
+	return c.CloseWithCode(CloseNormalClosure, "")
+}
+
+// fail closes the connection with the status code matching the error.
+func (c *Client) fail(err error) {
+	code := CloseCodeFor(err)
+	if code != CloseAbnormalClosure && !c.isCloseSent {
+		c.isCloseSent = true
+		c.WriteMessage(NewCloseMessage(code, err.Error()))
+	}
+
+	c.conn.Close()
+}
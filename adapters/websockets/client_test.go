@@ -0,0 +1,305 @@
+package websockets
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveOnce accepts a single connection, answers its handshake and
+// hands the connection over to the given session.
+func serveOnce(t *testing.T, respond func(request *http.Request) string, session func(conn net.Conn, reader *FrameReader)) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	serve(t, listener, respond, session)
+	return fmt.Sprintf("ws://%s/chats?room=1", listener.Addr())
+}
+
+func serve(t *testing.T, listener net.Listener, respond func(request *http.Request) string, session func(conn net.Conn, reader *FrameReader)) {
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		buffered := bufio.NewReader(conn)
+		request, err := http.ReadRequest(buffered)
+		if err != nil {
+			return
+		}
+
+		_, err = conn.Write([]uint8(respond(request)))
+		if err != nil {
+			return
+		}
+
+		session(conn, NewFrameReader(buffered, 64))
+	}()
+}
+
+func acceptResponse(extensions string) func(request *http.Request) string {
+	return func(request *http.Request) string {
+		response := "HTTP/1.1 101 Switching Protocols\r\n"
+		response += "Upgrade: websocket\r\n"
+		response += "Connection: Upgrade\r\n"
+		response += "Sec-WebSocket-Accept: " + ComputeAcceptKey(request.Header.Get("Sec-WebSocket-Key")) + "\r\n"
+		if extensions != "" {
+			response += "Sec-WebSocket-Extensions: " + extensions + "\r\n"
+		}
+		return response + "\r\n"
+	}
+}
+
+// echoSession echoes every data message back, pings the client before
+// each echo and closes with a normal closure once it receives a close.
+func echoSession(conn net.Conn, reader *FrameReader) {
+	assembler := NewMessageAssembler(1 << 20)
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			return
+		}
+
+		message, err := assembler.Push(frame)
+		if err != nil || message == nil {
+			continue
+		}
+
+		switch message.OpCode {
+		case OpConnectionClose:
+			conn.Write(NewFrame(OpConnectionClose, message.Data).Encode())
+			return
+		case OpPong:
+			continue
+		}
+
+		conn.Write(NewFrame(OpPing, []uint8("ping")).Encode())
+		conn.Write(NewFrame(message.OpCode, message.Data).Encode())
+	}
+}
+
+func TestClient(t *testing.T) {
+	var request *http.Request
+	url := serveOnce(t, func(r *http.Request) string {
+		request = r
+		return acceptResponse("")(r)
+	}, echoSession)
+
+	client, err := Dial(url)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+
+	if request.URL.RequestURI() != "/chats?room=1" {
+		t.Errorf("Expected request URI [/chats?room=1] found [%s]", request.URL.RequestURI())
+	}
+
+	if request.Header.Get("Sec-WebSocket-Version") != "13" {
+		t.Errorf("Expected Sec-WebSocket-Version [13] found [%s]", request.Header.Get("Sec-WebSocket-Version"))
+	}
+
+	for _, text := range []string{"Hello", string(make([]uint8, 70000))} {
+		err = client.WriteText(text)
+		if err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+
+		message, err := client.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+
+		if message.OpCode != OpTextFrame || string(message.Data) != text {
+			t.Errorf("Expected echo of length [%d] found [%d]", len(text), len(message.Data))
+		}
+	}
+
+	err = client.Close()
+	if err != nil {
+		t.Errorf("Unexpected close error: %v", err)
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	// Borrow the certificate httptest trusts for 127.0.0.1.
+	httpsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	certificate := httpsServer.TLS.Certificates[0]
+	roots := httpsServer.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	httpsServer.Close()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{certificate}})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	serve(t, listener, acceptResponse(""), echoSession)
+
+	dialer := &Dialer{
+		BufferSize:     2048,
+		MaxMessageSize: DefaultMaxPayloadLength,
+		TLSConfig:      &tls.Config{RootCAs: roots},
+	}
+
+	client, err := dialer.Dial(fmt.Sprintf("wss://%s/chats", listener.Addr()))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+
+	err = client.WriteText("Hello")
+	if err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	message, err := client.ReadMessage()
+	if err != nil || string(message.Data) != "Hello" {
+		t.Errorf("Expected echo [Hello] found [%v] %v", message, err)
+	}
+
+	err = client.Close()
+	if err != nil {
+		t.Errorf("Unexpected close error: %v", err)
+	}
+}
+
+func TestClientBadHandshake(t *testing.T) {
+	cases := []struct {
+		description string
+		respond     func(request *http.Request) string
+	}{
+		{
+			description: "rejected",
+			respond: func(request *http.Request) string {
+				return "HTTP/1.1 400 Bad Request\r\n\r\n"
+			},
+		},
+		{
+			description: "wrong accept key",
+			respond: func(request *http.Request) string {
+				request.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+				return acceptResponse("")(request)
+			},
+		},
+		{
+			description: "extension that wasn't offered",
+			respond:     acceptResponse(PerMessageDeflate),
+		},
+		{
+			description: "subprotocol that wasn't offered",
+			respond: func(request *http.Request) string {
+				response := acceptResponse("")(request)
+				return strings.TrimSuffix(response, "\r\n") + "Sec-WebSocket-Protocol: nony.v1.json\r\n\r\n"
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			url := serveOnce(t, c.respond, func(conn net.Conn, reader *FrameReader) {})
+
+			_, err := Dial(url)
+			if !errors.Is(err, ErrBadHandshake) {
+				t.Errorf("Expected [%v] found [%v]", ErrBadHandshake, err)
+			}
+		})
+	}
+}
+
+func TestClientSubprotocol(t *testing.T) {
+	var offered string
+	url := serveOnce(t, func(request *http.Request) string {
+		offered = request.Header.Get("Sec-WebSocket-Protocol")
+		response := acceptResponse("")(request)
+		return strings.TrimSuffix(response, "\r\n") + "Sec-WebSocket-Protocol: nony.v1.json\r\n\r\n"
+	}, func(conn net.Conn, reader *FrameReader) {})
+
+	dialer := *DefaultDialer
+	dialer.Subprotocols = []string{"nony.v2.msgpack", "nony.v1.json"}
+	client, err := dialer.Dial(url)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer client.conn.Close()
+
+	if offered != "nony.v2.msgpack, nony.v1.json" {
+		t.Errorf("Expected offer [nony.v2.msgpack, nony.v1.json] found [%s]", offered)
+	}
+
+	if client.Subprotocol() != "nony.v1.json" {
+		t.Errorf("Expected subprotocol [nony.v1.json] found [%s]", client.Subprotocol())
+	}
+}
+
+func TestClientCompression(t *testing.T) {
+	url := serveOnce(t, acceptResponse(PerMessageDeflate), func(conn net.Conn, reader *FrameReader) {
+		reader.EnableCompression()
+		deflate := NewServerDeflate(DeflateParams{})
+		assembler := NewMessageAssembler(1 << 20)
+		assembler.EnableCompression(deflate)
+
+		frame, err := reader.ReadFrame()
+		if err != nil || !frame.IsCompressed() {
+			return
+		}
+
+		message, err := assembler.Push(frame)
+		if err != nil {
+			return
+		}
+
+		echo, err := deflate.CompressFrame(NewFrame(message.OpCode, message.Data))
+		if err != nil {
+			return
+		}
+		conn.Write(echo.Encode())
+	})
+
+	dialer := *DefaultDialer
+	dialer.EnableCompression = true
+	client, err := dialer.Dial(url)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer client.conn.Close()
+
+	err = client.WriteText("Hello, Hello, Hello")
+	if err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	message, err := client.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+
+	if string(message.Data) != "Hello, Hello, Hello" {
+		t.Errorf("Expected [Hello, Hello, Hello] found [%s]", message.Data)
+	}
+}
+
+func TestClientRejectsMaskedFrames(t *testing.T) {
+	url := serveOnce(t, acceptResponse(""), func(conn net.Conn, reader *FrameReader) {
+		conn.Write(maskedFrame(true, OpTextFrame, []uint8("Hello")))
+		reader.ReadFrame()
+	})
+
+	client, err := Dial(url)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+
+	_, err = client.ReadMessage()
+	if !errors.Is(err, ErrMaskedServerFrame) {
+		t.Errorf("Expected [%v] found [%v]", ErrMaskedServerFrame, err)
+	}
+}
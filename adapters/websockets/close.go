@@ -0,0 +1,142 @@
+package websockets
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// https://datatracker.ietf.org/doc/html/rfc6455#section-7.4.1
+type CloseCode uint16
+
+const (
+	CloseNormalClosure           CloseCode = 1000
+	CloseGoingAway               CloseCode = 1001
+	CloseProtocolError           CloseCode = 1002
+	CloseUnsupportedData         CloseCode = 1003
+	CloseNoStatusReceived        CloseCode = 1005
+	CloseAbnormalClosure         CloseCode = 1006
+	CloseInvalidFramePayloadData CloseCode = 1007
+	ClosePolicyViolation         CloseCode = 1008
+	CloseMessageTooBig           CloseCode = 1009
+	CloseMandatoryExtension      CloseCode = 1010
+	CloseInternalServerError     CloseCode = 1011
+	CloseTLSHandshake            CloseCode = 1015
+)
+
+// Control frames carry at most 125 bytes, 2 of them are the status code.
+const maxCloseReasonLength = 125 - 2
+
+var ErrInvalidClosePayload = errors.New("Invalid close frame payload")
+
+// CloseError reports the status code and reason the peer closed the
+// connection with.
+type CloseError struct {
+	Code   CloseCode
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("Connection closed with code %d", e.Code)
+	}
+
+	return fmt.Sprintf("Connection closed with code %d: %s", e.Code, e.Reason)
+}
+
+// NewCloseMessage creates the payload of a close frame. The reason is
+// truncated to fit in a control frame.
+func NewCloseMessage(code CloseCode, reason string) *Message {
+	// 1005 is a reserved value and MUST NOT be set as a status code in a
+	// Close control frame by an endpoint. It is designated for use in
+	// applications expecting a status code to indicate that no status
+	// code was actually present.
+	if code == CloseNoStatusReceived {
+		return &Message{OpCode: OpConnectionClose, Data: []uint8{}}
+	}
+
+	for len(reason) > maxCloseReasonLength {
+		_, size := utf8.DecodeLastRuneInString(reason)
+		reason = reason[:len(reason)-size]
+	}
+
+	data := binary.BigEndian.AppendUint16(nil, uint16(code))
+	data = append(data, reason...)
+	return &Message{OpCode: OpConnectionClose, Data: data}
+}
+
+// ParseCloseMessage reads the status code and reason out of a close frame.
+// https://datatracker.ietf.org/doc/html/rfc6455#section-5.5.1
+// If there is a body, the first two bytes of the body MUST be a 2-byte
+// unsigned integer (in network byte order) representing a status code.
+// Following the 2-byte integer, the body MAY contain UTF-8-encoded data.
+func ParseCloseMessage(data []uint8) (*CloseError, error) {
+	if len(data) == 0 {
+		return &CloseError{Code: CloseNoStatusReceived}, nil
+	}
+
+	if len(data) < 2 {
+		return nil, ErrInvalidClosePayload
+	}
+
+	code := CloseCode(binary.BigEndian.Uint16(data))
+	if !isValidCloseCode(code) {
+		return nil, fmt.Errorf("%w: status code %d", ErrInvalidClosePayload, code)
+	}
+
+	reason := data[2:]
+	validator := UTF8Validator{}
+	err := validator.Validate(reason)
+	if err == nil {
+		err = validator.Finish()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidClosePayload, err)
+	}
+
+	return &CloseError{Code: code, Reason: string(reason)}, nil
+}
+
+// isValidCloseCode tells if the code may be sent on the wire.
+// https://datatracker.ietf.org/doc/html/rfc6455#section-7.4.2
+func isValidCloseCode(code CloseCode) bool {
+	switch {
+	case code >= 1000 && code <= 1003:
+		return true
+	case code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		// Reserved for use by libraries, frameworks and applications.
+		return true
+	}
+
+	return false
+}
+
+// CloseCodeFor maps an error returned while reading from the peer to the
+// status code the connection should be failed with. CloseAbnormalClosure
+// means there's no point in sending a close frame, e.g. the connection
+// is already gone.
+func CloseCodeFor(err error) CloseCode {
+	switch {
+	case errors.Is(err, ErrFrameTooLarge), errors.Is(err, ErrMessageTooLarge):
+		return CloseMessageTooBig
+	case errors.Is(err, ErrInvalidUTF8), errors.Is(err, ErrInvalidCompressedData):
+		return CloseInvalidFramePayloadData
+	case errors.Is(err, ErrReservedBitsSet),
+		errors.Is(err, ErrReservedOpCode),
+		errors.Is(err, ErrUnmaskedClientFrame),
+		errors.Is(err, ErrMaskedServerFrame),
+		errors.Is(err, ErrControlFrameTooLarge),
+		errors.Is(err, ErrFragmentedControlFrame),
+		errors.Is(err, ErrPayloadLengthMSB),
+		errors.Is(err, ErrTruncatedFrame),
+		errors.Is(err, ErrUnexpectedContinuation),
+		errors.Is(err, ErrExpectedContinuation),
+		errors.Is(err, ErrInvalidClosePayload):
+		return CloseProtocolError
+	}
+
+	return CloseAbnormalClosure
+}
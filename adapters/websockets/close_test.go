@@ -0,0 +1,104 @@
+package websockets
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestParseCloseMessage(t *testing.T) {
+	cases := []struct {
+		description string
+		input       []uint8
+		wantCode    CloseCode
+		wantReason  string
+		wantErr     error
+	}{
+		{
+			description: "no status code",
+			input:       []uint8{},
+			wantCode:    CloseNoStatusReceived,
+		},
+		{
+			description: "status code without reason",
+			input:       []uint8{0x03, 0xE8},
+			wantCode:    CloseNormalClosure,
+		},
+		{
+			description: "status code with reason",
+			input:       append([]uint8{0x03, 0xE9}, "bye"...),
+			wantCode:    CloseGoingAway,
+			wantReason:  "bye",
+		},
+		{
+			description: "application status code",
+			input:       []uint8{0x0F, 0xA0},
+			wantCode:    4000,
+		},
+		{
+			description: "truncated status code",
+			input:       []uint8{0x03},
+			wantErr:     ErrInvalidClosePayload,
+		},
+		{
+			description: "reserved status code",
+			input:       []uint8{0x03, 0xED},
+			wantErr:     ErrInvalidClosePayload,
+		},
+		{
+			description: "unassigned status code",
+			input:       []uint8{0x00, 0x01},
+			wantErr:     ErrInvalidClosePayload,
+		},
+		{
+			description: "invalid UTF-8 reason",
+			input:       []uint8{0x03, 0xE8, 0xC0, 0xAF},
+			wantErr:     ErrInvalidClosePayload,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			closeErr, err := ParseCloseMessage(c.input)
+			if !errors.Is(err, c.wantErr) {
+				t.Fatalf("Expected error [%v] found [%v]", c.wantErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if closeErr.Code != c.wantCode || closeErr.Reason != c.wantReason {
+				t.Errorf("Expected [%d %s] found [%d %s]", c.wantCode, c.wantReason, closeErr.Code, closeErr.Reason)
+			}
+		})
+	}
+}
+
+func TestNewCloseMessage(t *testing.T) {
+	reason := strings.Repeat("é", 100)
+	message := NewCloseMessage(CloseGoingAway, reason)
+
+	if len(message.Data) > 125 {
+		t.Fatalf("Expected close payload to fit in a control frame, found [%d] bytes", len(message.Data))
+	}
+
+	closeErr, err := ParseCloseMessage(message.Data)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if closeErr.Code != CloseGoingAway {
+		t.Errorf("Expected code [%d] found [%d]", CloseGoingAway, closeErr.Code)
+	}
+
+	if !utf8.ValidString(closeErr.Reason) || !strings.HasPrefix(reason, closeErr.Reason) {
+		t.Errorf("Expected a truncated reason found [%s]", closeErr.Reason)
+	}
+
+	empty := NewCloseMessage(CloseNoStatusReceived, "")
+	if len(empty.Data) != 0 {
+		t.Errorf("Expected an empty close payload found [%X]", empty.Data)
+	}
+}
@@ -0,0 +1,339 @@
+package websockets
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// https://datatracker.ietf.org/doc/html/rfc7692
+const PerMessageDeflate = "permessage-deflate"
+
+const (
+	serverNoContextTakeover = "server_no_context_takeover"
+	clientNoContextTakeover = "client_no_context_takeover"
+	serverMaxWindowBits     = "server_max_window_bits"
+	clientMaxWindowBits     = "client_max_window_bits"
+)
+
+// compress/flate always uses the largest LZ77 window.
+const maxWindowBits = 15
+const maxWindowSize = 1 << maxWindowBits
+
+// https://datatracker.ietf.org/doc/html/rfc7692#section-7.2.2
+// Append 4 octets of 0x00 0x00 0xff 0xff to the tail end of the payload
+// of the message, then decompress the resulting data using DEFLATE.
+// A final empty stored block follows so the decompressor stops cleanly
+// instead of waiting for more blocks.
+var deflateMessageTail = []uint8{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+var ErrInvalidCompressedData = errors.New("Invalid compressed message payload")
+
+// DeflateParams are the negotiated permessage-deflate parameters.
+type DeflateParams struct {
+	ServerNoContextTakeover bool
+	ClientNoContextTakeover bool
+}
+
+// NegotiateDeflate accepts the first permessage-deflate offer we can
+// honour. Offers are declined rather than failing the handshake.
+// https://datatracker.ietf.org/doc/html/rfc7692#section-7.1
+func NegotiateDeflate(offers []ExtensionOffer) (DeflateParams, bool) {
+	for _, offer := range offers {
+		if offer.Name != PerMessageDeflate || offer.HasDuplicateParams {
+			continue
+		}
+
+		params, ok := acceptDeflateOffer(offer)
+		if ok {
+			return params, true
+		}
+	}
+
+	return DeflateParams{}, false
+}
+
+func acceptDeflateOffer(offer ExtensionOffer) (DeflateParams, bool) {
+	params := DeflateParams{}
+
+	for key, value := range offer.Params {
+		switch key {
+		case serverNoContextTakeover:
+			if value != "" {
+				return DeflateParams{}, false
+			}
+			params.ServerNoContextTakeover = true
+		case clientNoContextTakeover:
+			if value != "" {
+				return DeflateParams{}, false
+			}
+			params.ClientNoContextTakeover = true
+		case serverMaxWindowBits:
+			// The compressor can't be limited to a smaller window,
+			// only offers allowing the full window are accepted.
+			bits, ok := parseWindowBits(value)
+			if !ok || bits != maxWindowBits {
+				return DeflateParams{}, false
+			}
+		case clientMaxWindowBits:
+			// A value-less parameter only says the client supports it.
+			// The decompressor handles any window size, there's no need
+			// to limit the client.
+			if value == "" {
+				continue
+			}
+			_, ok := parseWindowBits(value)
+			if !ok {
+				return DeflateParams{}, false
+			}
+		default:
+			// An unknown extension parameter declines the offer.
+			return DeflateParams{}, false
+		}
+	}
+
+	return params, true
+}
+
+func parseWindowBits(value string) (int, bool) {
+	bits, err := strconv.Atoi(value)
+	if err != nil || bits < 8 || bits > maxWindowBits {
+		return 0, false
+	}
+
+	return bits, true
+}
+
+// String is the accepted extension as sent back in the handshake
+// response's Sec-WebSocket-Extensions header.
+func (p DeflateParams) String() string {
+	parts := []string{PerMessageDeflate}
+	if p.ServerNoContextTakeover {
+		parts = append(parts, serverNoContextTakeover)
+	}
+
+	if p.ClientNoContextTakeover {
+		parts = append(parts, clientNoContextTakeover)
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// Deflate compresses outgoing and decompresses incoming messages of a
+// single connection, keeping the LZ77 window between messages unless
+// context takeover was disabled.
+type Deflate struct {
+	compressNoContextTakeover   bool
+	decompressNoContextTakeover bool
+
+	writer *flate.Writer
+	output bytes.Buffer
+
+	reader     io.ReadCloser
+	dictionary []uint8
+}
+
+// NewServerDeflate creates the compression context of the server side of
+// the connection, server_* parameters apply to the messages it sends.
+func NewServerDeflate(params DeflateParams) *Deflate {
+	return &Deflate{
+		compressNoContextTakeover:   params.ServerNoContextTakeover,
+		decompressNoContextTakeover: params.ClientNoContextTakeover,
+	}
+}
+
+// NewClientDeflate creates the compression context of the client side of
+// the connection, client_* parameters apply to the messages it sends.
+func NewClientDeflate(params DeflateParams) *Deflate {
+	return &Deflate{
+		compressNoContextTakeover:   params.ClientNoContextTakeover,
+		decompressNoContextTakeover: params.ServerNoContextTakeover,
+	}
+}
+
+// parseDeflateResponse reads the parameters the server accepted our
+// permessage-deflate offer with.
+// https://datatracker.ietf.org/doc/html/rfc7692#section-7.1
+func parseDeflateResponse(response ExtensionOffer) (DeflateParams, bool) {
+	if response.Name != PerMessageDeflate || response.HasDuplicateParams {
+		return DeflateParams{}, false
+	}
+
+	params := DeflateParams{}
+	for key, value := range response.Params {
+		switch key {
+		case serverNoContextTakeover:
+			params.ServerNoContextTakeover = true
+		case clientNoContextTakeover:
+			params.ClientNoContextTakeover = true
+		case serverMaxWindowBits:
+			// A smaller server window is fine to decompress.
+			_, ok := parseWindowBits(value)
+			if !ok {
+				return DeflateParams{}, false
+			}
+		default:
+			// client_max_window_bits wasn't offered, the
+			// compressor can't limit its window anyway.
+			return DeflateParams{}, false
+		}
+	}
+
+	return params, true
+}
+
+// CompressFrame creates a frame carrying the compressed payload with the
+// "Per-Message Compressed" bit (RSV1) set.
+func (d *Deflate) CompressFrame(frame *Frame) (*Frame, error) {
+	data, err := d.Compress(frame.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	compressed := NewFrame(frame.OpCode(), data)
+	compressed.header.Fin = frame.header.Fin
+	compressed.header.Rsv1 = true
+	return compressed, nil
+}
+
+// https://datatracker.ietf.org/doc/html/rfc7692#section-7.2.1
+// Compress all the octets of the payload of the message using DEFLATE.
+// If the resulting data does not end with an empty DEFLATE block with no
+// compression, append one, then remove 4 octets (0x00 0x00 0xff 0xff)
+// from the tail end.
+func (d *Deflate) Compress(data []uint8) ([]uint8, error) {
+	err := d.beginCompression()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = d.writer.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.endCompression()
+}
+
+// beginCompression prepares the compressor for a new message.
+func (d *Deflate) beginCompression() error {
+	d.output.Reset()
+
+	if d.writer == nil {
+		writer, err := flate.NewWriter(&d.output, flate.DefaultCompression)
+		if err != nil {
+			return err
+		}
+		d.writer = writer
+	} else if d.compressNoContextTakeover {
+		d.writer.Reset(&d.output)
+	}
+
+	return nil
+}
+
+// takeCompressed removes the compressed output produced so far, except
+// for the last 4 bytes which might turn out to be the tail that's
+// stripped once the message ends.
+func (d *Deflate) takeCompressed() []uint8 {
+	if d.output.Len() <= 4 {
+		return nil
+	}
+
+	return bytes.Clone(d.output.Next(d.output.Len() - 4))
+}
+
+// endCompression flushes the compressor and returns the rest
+// of the message's compressed output.
+func (d *Deflate) endCompression() ([]uint8, error) {
+	// Flush ends the output with an empty stored block.
+	err := d.writer.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	compressed := d.output.Bytes()
+	compressed = compressed[:len(compressed)-4]
+	return bytes.Clone(compressed), nil
+}
+
+// Decompress inflates a message payload, failing with ErrMessageTooLarge
+// as soon as the output grows past limit bytes.
+func (d *Deflate) Decompress(data []uint8, limit uint64) ([]uint8, error) {
+	reader, err := d.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// Reading a byte past the limit tells an output of exactly
+	// limit bytes from a larger one, without inflating the rest.
+	// Larger limits than a reader can count up to are as good as none.
+	limit = min(limit, math.MaxInt64-1)
+	output, err := io.ReadAll(io.LimitReader(reader, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if uint64(len(output)) > limit {
+		return nil, ErrMessageTooLarge
+	}
+
+	return output, nil
+}
+
+// NewReader streams the decompressed payload of a message.
+// The message must be read whole before the next one.
+func (d *Deflate) NewReader(compressed io.Reader) (io.Reader, error) {
+	input := io.MultiReader(compressed, bytes.NewReader(deflateMessageTail))
+
+	if d.decompressNoContextTakeover {
+		d.dictionary = nil
+	}
+
+	// Only the last window is referenced.
+	if len(d.dictionary) > maxWindowSize {
+		d.dictionary = bytes.Clone(d.dictionary[len(d.dictionary)-maxWindowSize:])
+	}
+
+	if d.reader == nil {
+		d.reader = flate.NewReaderDict(input, d.dictionary)
+		return &inflateReader{deflate: d}, nil
+	}
+
+	err := d.reader.(flate.Resetter).Reset(input, d.dictionary)
+	if err != nil {
+		return nil, err
+	}
+
+	return &inflateReader{deflate: d}, nil
+}
+
+// inflateReader keeps the decompressed output as the dictionary of the
+// next message when the context is taken over.
+type inflateReader struct {
+	deflate *Deflate
+}
+
+func (r *inflateReader) Read(buffer []uint8) (int, error) {
+	n, err := r.deflate.reader.Read(buffer)
+
+	if !r.deflate.decompressNoContextTakeover {
+		dictionary := append(r.deflate.dictionary, buffer[:n]...)
+		// Bound the memory kept for long streamed messages.
+		if len(dictionary) > 2*maxWindowSize {
+			dictionary = bytes.Clone(dictionary[len(dictionary)-maxWindowSize:])
+		}
+		r.deflate.dictionary = dictionary
+	}
+
+	if err != nil && err != io.EOF {
+		return n, fmt.Errorf("%w: %w", ErrInvalidCompressedData, err)
+	}
+
+	return n, err
+}
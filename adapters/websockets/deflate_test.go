@@ -0,0 +1,228 @@
+package websockets
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateDeflate(t *testing.T) {
+	cases := []struct {
+		description string
+		header      string
+		accepted    bool
+		response    string
+	}{
+		{
+			description: "no extensions offered",
+			header:      "",
+		},
+		{
+			description: "unsupported extension",
+			header:      "x-webkit-deflate-frame",
+		},
+		{
+			description: "browser offer",
+			header:      "permessage-deflate; client_max_window_bits",
+			accepted:    true,
+			response:    "permessage-deflate",
+		},
+		{
+			description: "no context takeover",
+			header:      "permessage-deflate; server_no_context_takeover; client_no_context_takeover",
+			accepted:    true,
+			response:    "permessage-deflate; server_no_context_takeover; client_no_context_takeover",
+		},
+		{
+			description: "full server window",
+			header:      "permessage-deflate; server_max_window_bits=15",
+			accepted:    true,
+			response:    "permessage-deflate",
+		},
+		{
+			description: "quoted window bits",
+			header:      "permessage-deflate; client_max_window_bits=\"10\"",
+			accepted:    true,
+			response:    "permessage-deflate",
+		},
+		{
+			description: "smaller server window falls back to the next offer",
+			header:      "permessage-deflate; server_max_window_bits=10, permessage-deflate; client_no_context_takeover",
+			accepted:    true,
+			response:    "permessage-deflate; client_no_context_takeover",
+		},
+		{
+			description: "smaller server window only",
+			header:      "permessage-deflate; server_max_window_bits=10",
+		},
+		{
+			description: "invalid window bits",
+			header:      "permessage-deflate; client_max_window_bits=16",
+		},
+		{
+			description: "value on a value-less parameter",
+			header:      "permessage-deflate; server_no_context_takeover=1",
+		},
+		{
+			description: "unknown parameter",
+			header:      "permessage-deflate; level=9",
+		},
+		{
+			description: "duplicate parameter",
+			header:      "permessage-deflate; client_no_context_takeover; client_no_context_takeover",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			params, accepted := NegotiateDeflate(ParseExtensions(c.header))
+			if accepted != c.accepted {
+				t.Fatalf("Expected accepted [%v] found [%v]", c.accepted, accepted)
+			}
+
+			if accepted && params.String() != c.response {
+				t.Errorf("Expected response [%s] found [%s]", c.response, params.String())
+			}
+		})
+	}
+}
+
+func TestDeflateRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	text := make([]uint8, 1000)
+	for i := range text {
+		text[i] = uint8('a' + random.Intn(26))
+	}
+
+	messages := []string{
+		string(text),
+		string(text),
+		"",
+		strings.Repeat("Hello, World! ", 10000),
+	}
+
+	cases := []struct {
+		description string
+		params      DeflateParams
+	}{
+		{
+			description: "context takeover",
+			params:      DeflateParams{},
+		},
+		{
+			description: "no context takeover",
+			params:      DeflateParams{ServerNoContextTakeover: true, ClientNoContextTakeover: true},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			// Messages sent by the server are decompressed by the client,
+			// a single context pair plays both roles here.
+			sender := NewServerDeflate(c.params)
+			receiver := NewServerDeflate(DeflateParams{
+				ClientNoContextTakeover: c.params.ServerNoContextTakeover,
+			})
+
+			sizes := []int{}
+			for _, message := range messages {
+				compressed, err := sender.Compress([]uint8(message))
+				if err != nil {
+					t.Fatalf("Unexpected compression error: %v", err)
+				}
+				sizes = append(sizes, len(compressed))
+
+				decompressed, err := receiver.Decompress(compressed, 1<<20)
+				if err != nil {
+					t.Fatalf("Unexpected decompression error: %v", err)
+				}
+
+				if string(decompressed) != message {
+					t.Fatalf("Expected message of length [%d] found [%d]", len(message), len(decompressed))
+				}
+			}
+
+			// With context takeover, the repeated message is
+			// compressed as a back reference to the first one.
+			isSmaller := sizes[1] < sizes[0]
+			if isSmaller == c.params.ServerNoContextTakeover {
+				t.Errorf("Unexpected size of the repeated message [%d] compared to [%d]", sizes[1], sizes[0])
+			}
+		})
+	}
+}
+
+func TestDeflateDecompressionLimit(t *testing.T) {
+	// A few KBs that inflate to 10MB.
+	bomb, err := NewServerDeflate(DeflateParams{}).Compress(make([]uint8, 10<<20))
+	if err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	_, err = NewServerDeflate(DeflateParams{}).Decompress(bomb, 1<<20)
+	if !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("Expected [%v] found [%v]", ErrMessageTooLarge, err)
+	}
+
+	// No limit.
+	compressed, err := NewServerDeflate(DeflateParams{}).Compress([]uint8("hello"))
+	if err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	decompressed, err := NewServerDeflate(DeflateParams{}).Decompress(compressed, math.MaxUint64)
+	if err != nil || string(decompressed) != "hello" {
+		t.Errorf("Expected [hello] found [%s] %v", decompressed, err)
+	}
+
+	_, err = NewServerDeflate(DeflateParams{}).Decompress([]uint8{0xFF, 0xFF, 0xFF}, 1<<20)
+	if !errors.Is(err, ErrInvalidCompressedData) {
+		t.Errorf("Expected [%v] found [%v]", ErrInvalidCompressedData, err)
+	}
+}
+
+func TestMessageAssemblerCompressed(t *testing.T) {
+	text := bytes.Repeat([]uint8("κόσμε "), 100)
+	deflate := NewServerDeflate(DeflateParams{})
+
+	compressed, err := deflate.CompressFrame(NewTextFrame(string(text)))
+	if err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	// Split the compressed payload in two fragments,
+	// only the first one has RSV1 set.
+	half := len(compressed.Data) / 2
+	first := testFrame(false, OpTextFrame, string(compressed.Data[:half]))
+	first.header.Rsv1 = true
+	last := testFrame(true, OpContinuationFrame, string(compressed.Data[half:]))
+
+	assembler := NewMessageAssembler(1 << 20)
+	_, err = assembler.Push(first)
+	if !errors.Is(err, ErrReservedBitsSet) {
+		t.Fatalf("Expected [%v] without compression enabled found [%v]", ErrReservedBitsSet, err)
+	}
+
+	assembler = NewMessageAssembler(1 << 20)
+	assembler.EnableCompression(NewServerDeflate(DeflateParams{}))
+	for _, frame := range []*Frame{first, last} {
+		message, err := assembler.Push(frame)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if message != nil && !bytes.Equal(message.Data, text) {
+			t.Errorf("Expected message of length [%d] found [%d]", len(text), len(message.Data))
+		}
+	}
+
+	assembler = NewMessageAssembler(100)
+	assembler.EnableCompression(NewServerDeflate(DeflateParams{}))
+	_, err = assembler.Push(compressed)
+	if !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("Expected [%v] past the decompressed size limit found [%v]", ErrMessageTooLarge, err)
+	}
+}
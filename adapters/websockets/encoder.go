@@ -0,0 +1,85 @@
+package websockets
+
+// NewFrame creates a final (non fragmented) frame that carries the given
+// payload. Frames sent by the server are never masked.
+// https://datatracker.ietf.org/doc/html/rfc6455#section-5.1
+// A server MUST NOT mask any frames that it sends to the client.
+func NewFrame(opCode FrameOpCode, data []uint8) *Frame {
+	return &Frame{
+		header: websocketHeader{
+			Fin:           true,
+			OpCode:        opCode,
+			PayloadLength: uint64(len(data)),
+		},
+		Data: data,
+	}
+}
+
+func NewTextFrame(text string) *Frame {
+	return NewFrame(OpTextFrame, []uint8(text))
+}
+
+func NewBinaryFrame(data []uint8) *Frame {
+	return NewFrame(OpBinaryFrame, data)
+}
+
+// Encode serializes the frame to its wire format, the payload is
+// masked if the frame has a masking key (i.e. it's sent by a client).
+//
+//	 0                   1                   2                   3
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-+-+-+-+-------+-+-------------+-------------------------------+
+//	|F|R|R|R| opcode|M| Payload len |    Extended payload length    |
+//	|I|S|S|S|  (4)  |A|     (7)     |             (16/64)           |
+//	|N|V|V|V|       |S|             |   (if payload len==126/127)   |
+//	| |1|2|3|       |K|             |                               |
+//	+-+-+-+-+-------+-+-------------+ - - - - - - - - - - - - - - - +
+func (f Frame) Encode() []uint8 {
+	length := uint64(len(f.Data))
+	mode := payloadLengthModeFor(length)
+
+	// Room for the masking key as well.
+	out := make([]uint8, 0, headerLength(mode)+4+len(f.Data))
+
+	first := uint8(f.header.OpCode) & 0x0F
+	if f.header.Fin {
+		first |= 1 << 7
+	}
+	if f.header.Rsv1 {
+		first |= 1 << 6
+	}
+	out = append(out, first)
+	out = appendPayloadLength(out, length, mode)
+	if !f.header.IsMasked {
+		return append(out, f.Data...)
+	}
+
+	out[1] |= 1 << 7
+	out = append(out, f.header.Mask[:]...)
+	payloadStart := len(out)
+	out = append(out, f.Data...)
+	unmask(out[payloadStart:], f.header.Mask)
+
+	return out
+}
+
+// setMask marks the frame to be masked with the given key when encoded.
+// https://datatracker.ietf.org/doc/html/rfc6455#section-5.3
+// The masking key is a 32-bit value chosen at random by the client.
+func (f *Frame) setMask(mask [4]uint8) {
+	f.header.IsMasked = true
+	f.header.Mask = mask
+}
+
+// headerLength is the size of an unmasked frame header
+// for the given payload length mode.
+func headerLength(mode payloadLengthMode) int {
+	switch mode {
+	case Extended16Bits:
+		return 2 + 2
+	case Extended64Bits:
+		return 2 + 8
+	}
+
+	return 2
+}
@@ -0,0 +1,77 @@
+package websockets
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeFrame(t *testing.T) {
+	cases := []struct {
+		description string
+		frame       *Frame
+		wantHeader  []uint8
+	}{
+		{
+			description: "empty text frame",
+			frame:       NewTextFrame(""),
+			wantHeader:  []uint8{0x81, 0x00},
+		},
+		{
+			description: "simple payload length",
+			frame:       NewTextFrame("Hello"),
+			wantHeader:  []uint8{0x81, 0x05},
+		},
+		{
+			description: "largest simple payload length",
+			frame:       NewBinaryFrame(make([]uint8, 125)),
+			wantHeader:  []uint8{0x82, 125},
+		},
+		{
+			description: "extended 16 bits payload length",
+			frame:       NewBinaryFrame(make([]uint8, 126)),
+			wantHeader:  []uint8{0x82, 126, 0x00, 126},
+		},
+		{
+			description: "largest extended 16 bits payload length",
+			frame:       NewBinaryFrame(make([]uint8, 0xFFFF)),
+			wantHeader:  []uint8{0x82, 126, 0xFF, 0xFF},
+		},
+		{
+			description: "extended 64 bits payload length",
+			frame:       NewBinaryFrame(make([]uint8, 0x10000)),
+			wantHeader:  []uint8{0x82, 127, 0, 0, 0, 0, 0, 0x01, 0x00, 0x00},
+		},
+		{
+			description: "control frame",
+			frame:       NewFrame(OpPong, []uint8("ping")),
+			wantHeader:  []uint8{0x8A, 0x04},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			out := c.frame.Encode()
+
+			if !bytes.HasPrefix(out, c.wantHeader) {
+				t.Fatalf("Expected header [%X] found [%X]", c.wantHeader, out[:len(c.wantHeader)])
+			}
+
+			payload := out[len(c.wantHeader):]
+			if !bytes.Equal(payload, c.frame.Data) {
+				t.Errorf("Expected payload of length [%d] found [%d]", len(c.frame.Data), len(payload))
+			}
+
+			parsed, err := newParser(out).parseFrame()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if parsed.header.OpCode != c.frame.header.OpCode {
+				t.Errorf("Expected parsed op code [%v] found [%v]", c.frame.header.OpCode, parsed.header.OpCode)
+			}
+
+			if parsed.header.PayloadLength != uint64(len(c.frame.Data)) {
+				t.Errorf("Expected parsed length [%d] found [%d]", len(c.frame.Data), parsed.header.PayloadLength)
+			}
+		})
+	}
+}
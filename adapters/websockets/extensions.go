@@ -0,0 +1,54 @@
+package websockets
+
+import "strings"
+
+// ExtensionOffer is a single extension the client offered in its
+// Sec-WebSocket-Extensions header, in the order of preference.
+// https://datatracker.ietf.org/doc/html/rfc6455#section-9.1
+//
+//	Sec-WebSocket-Extensions = extension-list
+//	extension-list = 1#extension
+//	extension = extension-token *( ";" extension-param )
+//	extension-param = token [ "=" (token | quoted-string) ]
+type ExtensionOffer struct {
+	Name string
+	// Parameters without a value map to an empty string.
+	Params map[string]string
+	// Parameters repeated in the same offer make it invalid.
+	HasDuplicateParams bool
+}
+
+func ParseExtensions(header string) []ExtensionOffer {
+	offers := []ExtensionOffer{}
+
+	for _, extension := range strings.Split(header, ",") {
+		parts := strings.Split(extension, ";")
+		name := strings.TrimSpace(parts[0])
+		if name == "" {
+			continue
+		}
+
+		offer := ExtensionOffer{
+			Name:   name,
+			Params: make(map[string]string),
+		}
+
+		for _, param := range parts[1:] {
+			key, value, _ := strings.Cut(param, "=")
+			key = strings.TrimSpace(key)
+			value = strings.Trim(strings.TrimSpace(value), "\"")
+			if key == "" {
+				continue
+			}
+
+			if _, ok := offer.Params[key]; ok {
+				offer.HasDuplicateParams = true
+			}
+			offer.Params[key] = value
+		}
+
+		offers = append(offers, offer)
+	}
+
+	return offers
+}
@@ -1,6 +1,7 @@
 package websockets
 
 import (
+	"errors"
 	"fmt"
 )
 
@@ -25,8 +26,20 @@ const (
 	_RxF
 )
 
+var (
+	ErrReservedBitsSet      = errors.New("Reserved bits set without a negotiated extension")
+	ErrReservedOpCode       = errors.New("Reserved op code")
+	ErrUnmaskedClientFrame  = errors.New("Client frames must be masked")
+	ErrMaskedServerFrame    = errors.New("Server frames must not be masked")
+	ErrControlFrameTooLarge = errors.New("Control frame payload exceeds 125 bytes")
+	ErrPayloadLengthMSB     = errors.New("Most significant bit of the 64 bit payload length is set")
+)
+
 type websocketHeader struct {
 	Fin           bool
+	Rsv1          bool
+	Rsv2          bool
+	Rsv3          bool
 	OpCode        FrameOpCode
 	IsMasked      bool
 	Mask          [4]byte
@@ -40,15 +53,85 @@ type Frame struct {
 	Data   []uint8
 }
 
-// TODO: rename this to parse or something, return result and error.
-func New(raw []uint8) *Frame {
+// Parse reads a whole frame sent by a client.
+func Parse(raw []uint8) (*Frame, error) {
 	parser := newParser(raw)
-	frame := parser.parseFrame()
+	frame, err := parser.parseFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateHeader(frame.header, true, false)
+	if err != nil {
+		return nil, err
+	}
+
 	if frame.header.IsMasked {
 		unmask(frame.Data, frame.header.Mask)
 	}
 
-	return &frame
+	return &frame, nil
+}
+
+// validateHeader rejects headers that RFC 6455 requires the
+// receiver to _Fail the WebSocket Connection_ for. RSV1 is allowed
+// once permessage-deflate is negotiated.
+func validateHeader(header websocketHeader, isFromClient bool, isCompressionEnabled bool) error {
+	// https://datatracker.ietf.org/doc/html/rfc6455#section-5.2
+	// RSV1, RSV2, RSV3: MUST be 0 unless an extension is negotiated that
+	// defines meanings for non-zero values.
+	if header.Rsv2 || header.Rsv3 {
+		return ErrReservedBitsSet
+	}
+
+	if header.Rsv1 {
+		// https://datatracker.ietf.org/doc/html/rfc7692#section-6.1
+		// An endpoint MUST NOT set the "Per-Message Compressed" bit of
+		// control frames and non-first fragments of a data message.
+		isFirstDataFrame := header.OpCode == OpTextFrame || header.OpCode == OpBinaryFrame
+		if !isCompressionEnabled || !isFirstDataFrame {
+			return ErrReservedBitsSet
+		}
+	}
+
+	if isReservedOpCode(header.OpCode) {
+		return fmt.Errorf("%w: %X", ErrReservedOpCode, uint8(header.OpCode))
+	}
+
+	// The server MUST close the connection upon receiving a frame that
+	// is not masked.
+	if isFromClient && !header.IsMasked {
+		return ErrUnmaskedClientFrame
+	}
+
+	// A client MUST close a connection if it detects a masked frame.
+	if !isFromClient && header.IsMasked {
+		return ErrMaskedServerFrame
+	}
+
+	// https://datatracker.ietf.org/doc/html/rfc6455#section-5.5
+	// All control frames MUST have a payload length of 125 bytes or less
+	// and MUST NOT be fragmented.
+	if header.OpCode&0x8 != 0 {
+		if header.PayloadLength > 125 {
+			return ErrControlFrameTooLarge
+		}
+
+		if !header.Fin {
+			return ErrFragmentedControlFrame
+		}
+	}
+
+	return nil
+}
+
+func isReservedOpCode(opCode FrameOpCode) bool {
+	switch opCode {
+	case OpContinuationFrame, OpTextFrame, OpBinaryFrame, OpConnectionClose, OpPing, OpPong:
+		return false
+	}
+
+	return true
 }
 
 func unmask(data []uint8, mask [4]byte) {
@@ -62,6 +145,7 @@ func (f Frame) String() string {
 	out := ""
 	out += "---------------------\n"
 	out += fmt.Sprintf(" Is Fin: %v\n", f.header.Fin)
+	out += fmt.Sprintf(" Rsv: %v %v %v\n", f.header.Rsv1, f.header.Rsv2, f.header.Rsv3)
 	out += fmt.Sprintf(" Op: %v\n", f.header.OpCode)
 	out += fmt.Sprintf(" Is Masked: %v\n", f.header.IsMasked)
 	out += fmt.Sprintf(" Mask: %x\n", f.header.Mask)
@@ -75,6 +159,23 @@ func (f Frame) String() string {
 
 // }
 
+func (f Frame) OpCode() FrameOpCode {
+	return f.header.OpCode
+}
+
+// IsCompressed tells if the "Per-Message Compressed" bit is set,
+// only the first frame of a message carries it.
+func (f Frame) IsCompressed() bool {
+	return f.header.Rsv1
+}
+
+// https://datatracker.ietf.org/doc/html/rfc6455#section-5.5
+// Control frames are identified by opcodes where the most significant
+// bit of the opcode is 1.
+func (f Frame) IsControl() bool {
+	return f.header.OpCode&0x8 != 0
+}
+
 func (f Frame) IsFragmented() bool {
 	return f.header.Fin == false || f.IsEndFragment()
 }
@@ -0,0 +1,209 @@
+package websockets
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// FrameDecoder cuts whole frames out of chunks of a byte stream, for
+// layers that are handed the bytes read off the wire rather than
+// reading them. A chunk might hold a part of a frame, or a frame
+// followed by (part of) the next one. Bytes that don't complete a frame
+// are kept for the next chunk.
+type FrameDecoder struct {
+	buffered             []uint8
+	maxPayloadLength     uint64
+	isCompressionEnabled bool
+
+	// The header of the frame at the start of the buffer, parsed once
+	// it's whole so a large payload arriving in many chunks doesn't
+	// have its header parsed again for each.
+	header     *websocketHeader
+	headerSize int
+}
+
+func NewFrameDecoder() *FrameDecoder {
+	return &FrameDecoder{
+		maxPayloadLength:     DefaultMaxPayloadLength,
+		isCompressionEnabled: false,
+	}
+}
+
+func (d *FrameDecoder) SetMaxPayloadLength(length uint64) {
+	d.maxPayloadLength = length
+}
+
+// EnableCompression accepts frames with RSV1 set once
+// permessage-deflate is negotiated.
+func (d *FrameDecoder) EnableCompression() {
+	d.isCompressionEnabled = true
+}
+
+// Push buffers the chunk and returns the frames it completed, in order.
+// Frames decoded before an invalid one are returned along with the error.
+func (d *FrameDecoder) Push(chunk []uint8) ([]*Frame, error) {
+	d.buffered = append(d.buffered, chunk...)
+
+	frames := []*Frame{}
+	consumed := 0
+	for {
+		frame, size, err := d.next(d.buffered[consumed:])
+		if errors.Is(err, ErrTruncatedFrame) {
+			break
+		}
+
+		if err != nil {
+			d.buffered = nil
+			d.header = nil
+			return frames, err
+		}
+
+		frames = append(frames, frame)
+		consumed += size
+	}
+
+	// The buffer is only copied once a frame is consumed, so the
+	// consumed frames aren't kept alive through the backing array.
+	if consumed > 0 {
+		d.buffered = bytes.Clone(d.buffered[consumed:])
+	}
+
+	return frames, nil
+}
+
+// next decodes the frame at the start of the buffer and tells how many
+// bytes it took, ErrTruncatedFrame means it's not all there yet.
+func (d *FrameDecoder) next(buffered []uint8) (*Frame, int, error) {
+	if d.header == nil {
+		err := d.parseHeader(buffered)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// Reject the frame before buffering its payload.
+		if d.header.PayloadLength > d.maxPayloadLength {
+			d.header = nil
+			return nil, 0, ErrFrameTooLarge
+		}
+	}
+
+	frameSize := d.headerSize + int(d.header.PayloadLength)
+	if len(buffered) < frameSize {
+		return nil, 0, ErrTruncatedFrame
+	}
+
+	data := bytes.Clone(buffered[d.headerSize:frameSize])
+
+	if d.header.IsMasked {
+		unmask(data, d.header.Mask)
+	}
+
+	frame := &Frame{
+		raw:    bytes.Clone(buffered[:d.headerSize]),
+		header: *d.header,
+		Data:   data,
+	}
+	d.header = nil
+
+	return frame, frameSize, nil
+}
+
+// NextFrame hands out the next frame with its payload streamed rather
+// than buffered: the bytes buffered so far come first, then the ones read
+// off the stream, unmasked as they're read. The maximum payload length
+// doesn't apply. The payload must be read whole before the decoder is
+// used again. Header bytes read before the stream fails are kept, so the
+// call can be retried, e.g. once a timed out read is over.
+func (d *FrameDecoder) NextFrame(stream io.Reader) (*Frame, io.Reader, error) {
+	if d.header == nil {
+		// The first two bytes tell how long the rest of the header is.
+		err := d.fill(stream, 2)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		mode, err := parseHeaderPayloadLengthMode(d.buffered[1])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		headerSize := headerLength(mode)
+		if parseBit(d.buffered[1], 0) {
+			headerSize += 4
+		}
+
+		err = d.fill(stream, headerSize)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = d.parseHeader(d.buffered)
+		if err != nil {
+			d.buffered = nil
+			return nil, nil, err
+		}
+	}
+
+	header := *d.header
+	raw := bytes.Clone(d.buffered[:d.headerSize])
+	buffered := d.buffered[d.headerSize:]
+	d.header = nil
+
+	var source io.Reader
+	if uint64(len(buffered)) >= header.PayloadLength {
+		// The payload is all there, maybe followed by the next frames.
+		source = bytes.NewReader(bytes.Clone(buffered[:header.PayloadLength]))
+		d.buffered = bytes.Clone(buffered[header.PayloadLength:])
+	} else {
+		source = io.MultiReader(bytes.NewReader(bytes.Clone(buffered)), stream)
+		d.buffered = nil
+	}
+
+	payload := &payloadReader{
+		reader:    source,
+		remaining: header.PayloadLength,
+		isMasked:  header.IsMasked,
+		mask:      header.Mask,
+	}
+
+	return &Frame{raw: raw, header: header}, payload, nil
+}
+
+// parseHeader parses and validates the header at the start of the buffer.
+func (d *FrameDecoder) parseHeader(buffered []uint8) error {
+	parser := newParser(buffered)
+	header, err := parser.parseHeader()
+	if err != nil {
+		return err
+	}
+
+	err = validateHeader(header, true, d.isCompressionEnabled)
+	if err != nil {
+		return err
+	}
+
+	d.header = &header
+	d.headerSize = parser.pointer
+	return nil
+}
+
+// fill reads off the stream until n bytes are buffered. What's read is
+// kept even if the stream fails before that.
+func (d *FrameDecoder) fill(stream io.Reader, n int) error {
+	for len(d.buffered) < n {
+		chunk := make([]uint8, n-len(d.buffered))
+		read, err := stream.Read(chunk)
+		d.buffered = append(d.buffered, chunk[:read]...)
+
+		if err == io.EOF && len(d.buffered) > 0 {
+			return io.ErrUnexpectedEOF
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
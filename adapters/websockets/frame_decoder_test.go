@@ -0,0 +1,172 @@
+package websockets
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestFrameDecoderPush(t *testing.T) {
+	payloads := [][]uint8{
+		[]uint8("Hello"),
+		bytes.Repeat([]uint8("b"), 126),
+		bytes.Repeat([]uint8("d"), 0x10000),
+		{},
+	}
+
+	stream := []uint8{}
+	for _, payload := range payloads {
+		stream = append(stream, maskedFrame(true, OpTextFrame, payload)...)
+	}
+
+	for _, size := range []int{1, 7, 3000, len(stream)} {
+		decoder := NewFrameDecoder()
+
+		frames := []*Frame{}
+		for start := 0; start < len(stream); start += size {
+			decoded, err := decoder.Push(stream[start:min(start+size, len(stream))])
+			if err != nil {
+				t.Fatalf("Chunks of [%d]: unexpected error: %v", size, err)
+			}
+			frames = append(frames, decoded...)
+		}
+
+		if len(frames) != len(payloads) {
+			t.Fatalf("Chunks of [%d]: expected [%d] frames found [%d]", size, len(payloads), len(frames))
+		}
+
+		for i, payload := range payloads {
+			if !bytes.Equal(frames[i].Data, payload) {
+				t.Errorf("Chunks of [%d]: frame [%d] expected payload of length [%d] found [%d]", size, i, len(payload), len(frames[i].Data))
+			}
+		}
+	}
+}
+
+func TestFrameDecoderErrors(t *testing.T) {
+	cases := []struct {
+		description string
+		chunk       []uint8
+		expected    error
+	}{
+		{
+			description: "unmasked client frame",
+			chunk:       NewFrame(OpTextFrame, []uint8("Hello")).Encode(),
+			expected:    ErrUnmaskedClientFrame,
+		},
+		{
+			description: "frame too large",
+			chunk:       maskedFrame(true, OpBinaryFrame, make([]uint8, 200)),
+			expected:    ErrFrameTooLarge,
+		},
+		{
+			description: "compressed without negotiation",
+			chunk:       []uint8{0xC1, 0x80, 0, 0, 0, 0},
+			expected:    ErrReservedBitsSet,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			decoder := NewFrameDecoder()
+			decoder.SetMaxPayloadLength(125)
+
+			// A valid frame ahead of the bad one is still returned.
+			chunk := append(maskedFrame(true, OpTextFrame, []uint8("ok")), c.chunk...)
+			frames, err := decoder.Push(chunk)
+			if !errors.Is(err, c.expected) {
+				t.Errorf("Expected [%v] found [%v]", c.expected, err)
+			}
+
+			if len(frames) != 1 || string(frames[0].Data) != "ok" {
+				t.Errorf("Expected the frame ahead of the bad one, found [%d] frames", len(frames))
+			}
+		})
+	}
+}
+
+func TestFrameDecoderNextFrame(t *testing.T) {
+	payloads := [][]uint8{
+		[]uint8("Hello"),
+		bytes.Repeat([]uint8("b"), 126),
+		bytes.Repeat([]uint8("d"), 0x10000),
+		{},
+	}
+
+	stream := []uint8{}
+	for _, payload := range payloads {
+		stream = append(stream, maskedFrame(true, OpBinaryFrame, payload)...)
+	}
+
+	for _, size := range []int{1, 7, 3000, len(stream)} {
+		decoder := NewFrameDecoder()
+		// Streamed payloads aren't bounded.
+		decoder.SetMaxPayloadLength(125)
+
+		// Part of the stream pushed first is streamed from the buffer.
+		frames, err := decoder.Push(stream[:3])
+		if err != nil || len(frames) != 0 {
+			t.Fatalf("Chunks of [%d]: expected no frames found [%d] %v", size, len(frames), err)
+		}
+
+		reader := &chunkReader{data: stream[3:], size: size}
+		for i, expected := range payloads {
+			frame, payload, err := decoder.NextFrame(reader)
+			if err != nil {
+				t.Fatalf("Chunks of [%d]: unexpected error: %v", size, err)
+			}
+
+			data, err := io.ReadAll(payload)
+			if err != nil || frame.OpCode() != OpBinaryFrame || !bytes.Equal(data, expected) {
+				t.Errorf("Chunks of [%d]: frame [%d] expected payload of length [%d] found [%d] %v", size, i, len(expected), len(data), err)
+			}
+		}
+
+		_, _, err = decoder.NextFrame(reader)
+		if err != io.EOF {
+			t.Errorf("Chunks of [%d]: expected [%v] found [%v]", size, io.EOF, err)
+		}
+	}
+}
+
+// failingReader fails once after handing out its data.
+type failingReader struct {
+	data   []uint8
+	err    error
+	isDone bool
+}
+
+func (f *failingReader) Read(p []uint8) (int, error) {
+	if len(f.data) == 0 && !f.isDone {
+		f.isDone = true
+		return 0, f.err
+	}
+
+	n := copy(p, f.data)
+	f.data = f.data[n:]
+	return n, nil
+}
+
+func TestFrameDecoderNextFrameRetry(t *testing.T) {
+	frame := maskedFrame(true, OpTextFrame, []uint8("Hello"))
+	timeout := errors.New("timeout")
+
+	// The header is cut short by a failed read, the bytes already
+	// read aren't lost.
+	decoder := NewFrameDecoder()
+	_, _, err := decoder.NextFrame(&failingReader{data: frame[:3], err: timeout})
+	if !errors.Is(err, timeout) {
+		t.Fatalf("Expected [%v] found [%v]", timeout, err)
+	}
+
+	_, payload, err := decoder.NextFrame(bytes.NewReader(frame[3:]))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, err := io.ReadAll(payload)
+	if err != nil || string(data) != "Hello" {
+		t.Errorf("Expected [Hello] found [%s] %v", data, err)
+	}
+}
@@ -0,0 +1,164 @@
+package websockets
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// DefaultMaxPayloadLength caps the payload a single frame may carry,
+// the 64 bit payload length would otherwise let a peer make us
+// allocate an arbitrary amount of memory.
+const DefaultMaxPayloadLength = 16 << 20
+
+var ErrFrameTooLarge = errors.New("Frame payload exceeds the maximum length")
+
+// FrameReader reads whole frames off a byte stream. A single read on the
+// underlying stream might return a part of a frame, or a frame followed
+// by (part of) the next one. Bytes that don't belong to the frame being
+// read are kept buffered for the next call.
+type FrameReader struct {
+	reader               *bufio.Reader
+	maxPayloadLength     uint64
+	isCompressionEnabled bool
+	// Frames are read by the server unless the reader belongs to a Client.
+	isFromClient bool
+}
+
+func NewFrameReader(reader io.Reader, bufferSize int) *FrameReader {
+	return &FrameReader{
+		reader:               bufio.NewReaderSize(reader, bufferSize),
+		maxPayloadLength:     DefaultMaxPayloadLength,
+		isCompressionEnabled: false,
+		isFromClient:         true,
+	}
+}
+
+func (r *FrameReader) SetMaxPayloadLength(length uint64) {
+	r.maxPayloadLength = length
+}
+
+// EnableCompression accepts frames with RSV1 set once
+// permessage-deflate is negotiated.
+func (r *FrameReader) EnableCompression() {
+	r.isCompressionEnabled = true
+}
+
+// ReadFrame blocks until a whole frame is available. io.EOF is returned
+// only if the stream ended on a frame boundary.
+func (r *FrameReader) ReadFrame() (*Frame, error) {
+	frame, err := r.readHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	// Reject the frame before allocating its payload.
+	if frame.header.PayloadLength > r.maxPayloadLength {
+		return nil, ErrFrameTooLarge
+	}
+
+	data := make([]uint8, frame.header.PayloadLength)
+	_, err = io.ReadFull(r.reader, data)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	if frame.header.IsMasked {
+		unmask(data, frame.header.Mask)
+	}
+
+	frame.Data = data
+	return frame, nil
+}
+
+// readHeader reads and validates the next frame header, the frame
+// payload is left unread.
+func (r *FrameReader) readHeader() (*Frame, error) {
+	// The first two bytes hold the payload length mode and the mask bit
+	// which are enough to tell how long the rest of the header is.
+	head, err := r.reader.Peek(2)
+	if err != nil {
+		if err == io.EOF && len(head) > 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	mode, err := parseHeaderPayloadLengthMode(head[1])
+	if err != nil {
+		return nil, err
+	}
+
+	headerSize := headerLength(mode)
+	if parseBit(head[1], 0) {
+		headerSize += 4
+	}
+
+	raw := make([]uint8, headerSize)
+	_, err = io.ReadFull(r.reader, raw)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	parser := newParser(raw)
+	header, err := parser.parseHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateHeader(header, r.isFromClient, r.isCompressionEnabled)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Frame{
+		raw:    raw,
+		header: header,
+	}, nil
+}
+
+// payloadReader reads exactly the payload of a single frame,
+// unmasking it as it's read.
+type payloadReader struct {
+	reader    io.Reader
+	remaining uint64
+	isMasked  bool
+	mask      [4]uint8
+	// Position in the payload, the mask is applied relative to it.
+	offset int
+}
+
+func (p *payloadReader) Read(buffer []uint8) (int, error) {
+	if p.remaining == 0 {
+		return 0, io.EOF
+	}
+
+	if uint64(len(buffer)) > p.remaining {
+		buffer = buffer[:p.remaining]
+	}
+
+	n, err := p.reader.Read(buffer)
+	p.remaining -= uint64(n)
+
+	if p.isMasked {
+		for i := range buffer[:n] {
+			buffer[i] ^= p.mask[(p.offset+i)%len(p.mask)]
+		}
+		p.offset += n
+	}
+
+	if err == io.EOF && p.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
+
+// unexpectedEOF reports a stream that ended in the middle of a frame.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
@@ -0,0 +1,139 @@
+package websockets
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// maskedFrame builds a client frame the way a browser would send it.
+func maskedFrame(fin bool, opCode FrameOpCode, payload []uint8) []uint8 {
+	frame := NewFrame(opCode, payload)
+	frame.header.Fin = fin
+	frame.setMask([4]uint8{0x11, 0x22, 0x33, 0x44})
+	return frame.Encode()
+}
+
+// chunkReader returns at most size bytes per read, splitting
+// frames across reads the way TCP segments would.
+type chunkReader struct {
+	data []uint8
+	size int
+}
+
+func (c *chunkReader) Read(p []uint8) (int, error) {
+	if len(c.data) == 0 {
+		return 0, io.EOF
+	}
+
+	n := min(c.size, len(p), len(c.data))
+	copy(p, c.data[:n])
+	c.data = c.data[n:]
+	return n, nil
+}
+
+func TestReadFrame(t *testing.T) {
+	payloads := [][]uint8{
+		[]uint8("Hello"),
+		bytes.Repeat([]uint8("a"), 125),
+		bytes.Repeat([]uint8("b"), 126),
+		bytes.Repeat([]uint8("c"), 5000),
+		bytes.Repeat([]uint8("d"), 0x10000),
+		{},
+	}
+
+	stream := []uint8{}
+	for _, payload := range payloads {
+		stream = append(stream, maskedFrame(true, OpTextFrame, payload)...)
+	}
+
+	cases := []struct {
+		description string
+		reader      io.Reader
+	}{
+		{
+			description: "all frames coalesced in a single read",
+			reader:      bytes.NewReader(stream),
+		},
+		{
+			description: "one byte per read",
+			reader:      iotest.OneByteReader(bytes.NewReader(stream)),
+		},
+		{
+			description: "frames split across reads",
+			reader:      &chunkReader{data: stream, size: 7},
+		},
+		{
+			description: "reads larger than the buffer",
+			reader:      &chunkReader{data: stream, size: 3000},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			reader := NewFrameReader(c.reader, 64)
+
+			for i, payload := range payloads {
+				frame, err := reader.ReadFrame()
+				if err != nil {
+					t.Fatalf("Frame [%d]: unexpected error %v", i, err)
+				}
+
+				if !bytes.Equal(frame.Data, payload) {
+					t.Fatalf("Frame [%d]: expected payload of length [%d] found [%d]", i, len(payload), len(frame.Data))
+				}
+			}
+
+			_, err := reader.ReadFrame()
+			if err != io.EOF {
+				t.Errorf("Expected [%v] after the last frame found [%v]", io.EOF, err)
+			}
+		})
+	}
+}
+
+func TestReadFrameTruncated(t *testing.T) {
+	frame := maskedFrame(true, OpTextFrame, []uint8("Hello, World!"))
+
+	cases := []struct {
+		description string
+		input       []uint8
+	}{
+		{
+			description: "partial first byte pair",
+			input:       frame[:1],
+		},
+		{
+			description: "partial mask",
+			input:       frame[:4],
+		},
+		{
+			description: "partial payload",
+			input:       frame[:len(frame)-1],
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			reader := NewFrameReader(bytes.NewReader(c.input), 64)
+			_, err := reader.ReadFrame()
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("Expected [%v] found [%v]", io.ErrUnexpectedEOF, err)
+			}
+		})
+	}
+}
+
+func TestReadFrameTooLarge(t *testing.T) {
+	frame := maskedFrame(true, OpBinaryFrame, make([]uint8, 1024))
+
+	reader := NewFrameReader(bytes.NewReader(frame), 64)
+	reader.SetMaxPayloadLength(1023)
+
+	_, err := reader.ReadFrame()
+	if !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("Expected [%v] found [%v]", ErrFrameTooLarge, err)
+	}
+}
@@ -1,6 +1,7 @@
 package websockets
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -114,7 +115,11 @@ func TestParsePayloadLengthMode(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		out := parseHeaderPayloadLengthMode(c.inputPayloadLengthByte)
+		out, err := parseHeaderPayloadLengthMode(c.inputPayloadLengthByte)
+		if err != nil {
+			t.Errorf("Unexpected error for [%v]: %v", c.inputPayloadLengthByte, err)
+		}
+
 		if out != c.outputLengthMode {
 			t.Errorf("Expected length mode to be [%v] found [%v]", c.outputLengthMode, out)
 		}
@@ -127,6 +132,7 @@ func TestParsePayloadLength(t *testing.T) {
 		input           []uint8
 		inputLengthMode payloadLengthMode
 		outputLength    uint64
+		fails           bool
 	}{
 		{
 			description:     "if 0-125, that is the payload length",
@@ -154,9 +160,15 @@ func TestParsePayloadLength(t *testing.T) {
 		},
 		{
 			description:     "If 127, the following 8 bytes interpreted as a 64-bit unsigned integer (the most significant bit MUST be 0)",
+			input:           []byte{127, 0x7F, 0xCD, 0xAB, 0x89, 0x67, 0x45, 0x23, 0x01},
+			outputLength:    0x7FCDAB8967452301,
+			inputLengthMode: Extended64Bits,
+		},
+		{
+			description:     "If 127, a 64-bit length with the most significant bit set is invalid",
 			input:           []byte{127, 0xEF, 0xCD, 0xAB, 0x89, 0x67, 0x45, 0x23, 0x01},
-			outputLength:    0xEFCDAB8967452301,
 			inputLengthMode: Extended64Bits,
+			fails:           true,
 		},
 	}
 
@@ -165,7 +177,17 @@ func TestParsePayloadLength(t *testing.T) {
 			parser := FrameParser{
 				raw: c.input,
 			}
-			out := parser.parseHeaderPayloadLength(c.inputLengthMode)
+			out, err := parser.parseHeaderPayloadLength(c.inputLengthMode)
+			if c.fails {
+				if err == nil {
+					t.Errorf("Expected error for input [%v]", c.input)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error for input [%v]: %v", c.input, err)
+			}
 
 			if out != c.outputLength {
 				t.Errorf("Input [%v] Expected: [%X] found [%X]", c.input, c.outputLength, out)
@@ -204,7 +226,10 @@ func TestParsePayloadMask(t *testing.T) {
 
 	for _, c := range cases {
 		t.Run(c.description, func(t *testing.T) {
-			frame := New(c.input)
+			frame, err := newParser(c.input).parseFrame()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 
 			if frame.header.IsMasked != c.wantMasked {
 				t.Errorf("IsMasked = %v, want %v", frame.header.IsMasked, c.wantMasked)
@@ -254,3 +279,81 @@ func TestUnmask(t *testing.T) {
 		})
 	}
 }
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		description string
+		input       []byte
+		wantErr     error
+		wantData    string
+	}{
+		{
+			description: "masked text frame",
+			input:       maskedFrame(true, OpTextFrame, []uint8("Hello")),
+			wantData:    "Hello",
+		},
+		{
+			description: "masked ping frame",
+			input:       maskedFrame(true, OpPing, []uint8("ping")),
+			wantData:    "ping",
+		},
+		{
+			description: "unmasked client frame",
+			input:       []byte{0x81, 0x05, 'H', 'e', 'l', 'l', 'o'},
+			wantErr:     ErrUnmaskedClientFrame,
+		},
+		{
+			description: "RSV1 set",
+			input:       []byte{0xC1, 0x80, 0x11, 0x22, 0x33, 0x44},
+			wantErr:     ErrReservedBitsSet,
+		},
+		{
+			description: "RSV2 set",
+			input:       []byte{0xA1, 0x80, 0x11, 0x22, 0x33, 0x44},
+			wantErr:     ErrReservedBitsSet,
+		},
+		{
+			description: "RSV3 set",
+			input:       []byte{0x91, 0x80, 0x11, 0x22, 0x33, 0x44},
+			wantErr:     ErrReservedBitsSet,
+		},
+		{
+			description: "reserved non-control op code",
+			input:       []byte{0x83, 0x80, 0x11, 0x22, 0x33, 0x44},
+			wantErr:     ErrReservedOpCode,
+		},
+		{
+			description: "reserved control op code",
+			input:       []byte{0x8B, 0x80, 0x11, 0x22, 0x33, 0x44},
+			wantErr:     ErrReservedOpCode,
+		},
+		{
+			description: "control frame over 125 bytes",
+			input:       maskedFrame(true, OpPing, make([]uint8, 126)),
+			wantErr:     ErrControlFrameTooLarge,
+		},
+		{
+			description: "fragmented control frame",
+			input:       maskedFrame(false, OpPing, []uint8("ping")),
+			wantErr:     ErrFragmentedControlFrame,
+		},
+		{
+			description: "64-bit length with the most significant bit set",
+			input:       []byte{0x82, 0xFF, 0x80, 0, 0, 0, 0, 0, 0, 0, 0x11, 0x22, 0x33, 0x44},
+			wantErr:     ErrPayloadLengthMSB,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			frame, err := Parse(c.input)
+			if !errors.Is(err, c.wantErr) {
+				t.Fatalf("Expected error [%v] found [%v]", c.wantErr, err)
+			}
+
+			if err == nil && string(frame.Data) != c.wantData {
+				t.Errorf("Expected data [%s] found [%s]", c.wantData, frame.Data)
+			}
+		})
+	}
+}
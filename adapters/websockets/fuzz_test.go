@@ -0,0 +1,74 @@
+package websockets
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Seeds taken from the table tests.
+var fuzzSeeds = [][]byte{
+	// TestParsePayloadMask
+	{0x81, 0x00},
+	{0x81, 0x80, 0xAA, 0xBB, 0xCC, 0xDD},
+	{0x81, 0x85, 0x11, 0x22, 0x33, 0x44, 0x01, 0x02, 0x03, 0x04, 0x05},
+	// TestParsePayloadLength
+	{0x82, 126, 0, 0xFF},
+	{0x82, 126, 0xFF, 0xFF},
+	{0x82, 127, 0x7F, 0xCD, 0xAB, 0x89, 0x67, 0x45, 0x23, 0x01},
+	{0x82, 127, 0xEF, 0xCD, 0xAB, 0x89, 0x67, 0x45, 0x23, 0x01},
+	// TestParse
+	{0x81, 0x05, 'H', 'e', 'l', 'l', 'o'},
+	{0xC1, 0x80, 0x11, 0x22, 0x33, 0x44},
+	{0x83, 0x80, 0x11, 0x22, 0x33, 0x44},
+	{0x8B, 0x80, 0x11, 0x22, 0x33, 0x44},
+	{0x82, 0xFF, 0x80, 0, 0, 0, 0, 0, 0, 0, 0x11, 0x22, 0x33, 0x44},
+	// Truncated headers
+	{},
+	{0x81},
+	{0x81, 0xFE, 0x00},
+	{0x81, 0xFF, 0x00, 0x00, 0x00},
+	{0x81, 0x85, 0x11, 0x22},
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Add(maskedFrame(true, OpTextFrame, []uint8("Hello")))
+	f.Add(maskedFrame(false, OpPing, []uint8("ping")))
+	f.Add(maskedFrame(true, OpBinaryFrame, make([]uint8, 126)))
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		frame, err := Parse(raw)
+		if err != nil {
+			return
+		}
+
+		if uint64(len(frame.Data)) != frame.header.PayloadLength {
+			t.Errorf("Expected [%d] bytes of data found [%d]", frame.header.PayloadLength, len(frame.Data))
+		}
+	})
+}
+
+func FuzzReadFrame(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Add(append(maskedFrame(false, OpTextFrame, []uint8("Hel")), maskedFrame(true, OpContinuationFrame, []uint8("lo"))...))
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		reader := NewFrameReader(bytes.NewReader(raw), 64)
+		reader.SetMaxPayloadLength(1 << 16)
+
+		for {
+			frame, err := reader.ReadFrame()
+			if err != nil {
+				return
+			}
+
+			if uint64(len(frame.Data)) != frame.header.PayloadLength {
+				t.Fatalf("Expected [%d] bytes of data found [%d]", frame.header.PayloadLength, len(frame.Data))
+			}
+		}
+	})
+}
@@ -0,0 +1,29 @@
+package websockets
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"strings"
+)
+
+// https://datatracker.ietf.org/doc/html/rfc6455#section-4.1
+// If the response lacks a |Sec-WebSocket-Accept| header field or
+// the |Sec-WebSocket-Accept| contains a value other than the
+// base64-encoded SHA-1 of the concatenation of the |Sec-WebSocket-
+// Key| (as a string, not base64-decoded) with the string "258EAFA5-
+// E914-47DA-95CA-C5AB0DC85B11" but ignoring any leading and
+// trailing whitespace, the client MUST _Fail the WebSocket
+// Connection_.
+const rfc6455ServerResponseGuid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ComputeAcceptKey derives the Sec-WebSocket-Accept value the server
+// answers the client's Sec-WebSocket-Key with.
+func ComputeAcceptKey(websocketKey string) string {
+	trimmed := strings.TrimSpace(websocketKey)
+	handshakeAccept := trimmed + rfc6455ServerResponseGuid
+	hasher := sha1.New()
+	hasher.Write([]byte(handshakeAccept))
+	data := hasher.Sum(nil)
+
+	return base64.StdEncoding.EncodeToString(data)
+}
@@ -30,54 +30,86 @@ type PayloadLength struct {
 	Mode   payloadLengthMode
 }
 
-func parseHeaderPayloadLengthMode(input uint8) payloadLengthMode {
+func parseHeaderPayloadLengthMode(input uint8) (payloadLengthMode, error) {
 	payloadLen := input & 0x7F
 	// Most common case first
 	if payloadLen < 126 {
-		return Simple
+		return Simple, nil
 	}
 
 	if payloadLen == 126 {
-		return Extended16Bits
+		return Extended16Bits, nil
 	}
 
 	if payloadLen == 127 {
-		return Extended64Bits
+		return Extended64Bits, nil
 	}
 
-	panic(fmt.Sprintf("Invalid payload length: %d", payloadLen))
+	return Simple, fmt.Errorf("Invalid payload length: %d", payloadLen)
 }
 
-func (p *FrameParser) parseHeaderPayloadLength(mode payloadLengthMode) uint64 {
-	payloadLenPointer := p.pointer
+func (p *FrameParser) parseHeaderPayloadLength(mode payloadLengthMode) (uint64, error) {
 	switch mode {
 	case Simple:
 		// if 0-125, that is the payload length
-		return uint64(p.getCurrentByte())
+		current, err := p.getCurrentByte()
+		if err != nil {
+			return 0, err
+		}
+		return uint64(current & 0x7F), nil
 	case Extended16Bits:
 		// Extended -> uint16
 		// If 126, the following 2 bytes interpreted as a
 		// 16-bit unsigned integer are the payload length
-		lenContainer := []uint8{
-			p.raw[payloadLenPointer+1],
-			p.raw[payloadLenPointer+2],
+		lenContainer, err := p.take(1 + 2)
+		if err != nil {
+			return 0, err
 		}
-		return uint64(binary.BigEndian.Uint16(lenContainer))
+		return uint64(binary.BigEndian.Uint16(lenContainer[1:])), nil
 	case Extended64Bits:
 		// Extended -> uint64
 		// If 127, the following 8 bytes interpreted as
 		// a 64-bit unsigned integer (the most significant
 		// bit MUST be 0) are the payload length
-		return binary.BigEndian.Uint64([]uint8{
-			p.raw[payloadLenPointer+1],
-			p.raw[payloadLenPointer+2],
-			p.raw[payloadLenPointer+3],
-			p.raw[payloadLenPointer+4],
-			p.raw[payloadLenPointer+5],
-			p.raw[payloadLenPointer+6],
-			p.raw[payloadLenPointer+7],
-			p.raw[payloadLenPointer+8],
-		})
+		lenContainer, err := p.take(1 + 8)
+		if err != nil {
+			return 0, err
+		}
+		length := binary.BigEndian.Uint64(lenContainer[1:])
+		if length&(1<<63) != 0 {
+			return 0, ErrPayloadLengthMSB
+		}
+		return length, nil
+	}
+	return 0, fmt.Errorf("Invalid payload length mode: %d", mode)
+}
+
+// payloadLengthModeFor picks the smallest encoding that fits the length.
+// https://datatracker.ietf.org/doc/html/rfc6455#section-5.2
+// The payload length MUST be encoded in the minimal number of bytes.
+func payloadLengthModeFor(length uint64) payloadLengthMode {
+	if length < 126 {
+		return Simple
+	}
+
+	if length <= 0xFFFF {
+		return Extended16Bits
+	}
+
+	return Extended64Bits
+}
+
+// appendPayloadLength appends the 7 bit payload length and the extended
+// payload length (if any) to dst. The mask bit is left unset.
+func appendPayloadLength(dst []uint8, length uint64, mode payloadLengthMode) []uint8 {
+	switch mode {
+	case Extended16Bits:
+		dst = append(dst, 126)
+		return binary.BigEndian.AppendUint16(dst, uint16(length))
+	case Extended64Bits:
+		dst = append(dst, 127)
+		return binary.BigEndian.AppendUint64(dst, length)
 	}
-	panic(fmt.Sprintf("Invalid payload length mode"))
+
+	return append(dst, uint8(length))
 }
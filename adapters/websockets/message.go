@@ -0,0 +1,178 @@
+package websockets
+
+import "errors"
+
+var (
+	ErrUnexpectedContinuation = errors.New("Continuation frame received without a fragmented message in progress")
+	ErrExpectedContinuation   = errors.New("Data frame received while a fragmented message is in progress")
+	ErrFragmentedControlFrame = errors.New("Control frames must not be fragmented")
+	ErrMessageTooLarge        = errors.New("Message exceeds the maximum size")
+)
+
+// Message is the application level unit carried by one or more frames.
+type Message struct {
+	OpCode FrameOpCode
+	Data   []uint8
+}
+
+func (m Message) IsControl() bool {
+	return m.OpCode&0x8 != 0
+}
+
+// MessageAssembler joins fragmented frames back into whole messages.
+// https://datatracker.ietf.org/doc/html/rfc6455#section-5.4
+// A fragmented message consists of a single frame with the FIN bit
+// clear and an opcode other than 0, followed by zero or more frames
+// with the FIN bit clear and the opcode set to 0, and terminated by
+// a single frame with the FIN bit set and an opcode of 0.
+type MessageAssembler struct {
+	maxMessageSize uint64
+	deflate        *Deflate
+
+	isAssembling bool
+	opCode       FrameOpCode
+	isCompressed bool
+	fragments    []uint8
+	validator    UTF8Validator
+}
+
+func NewMessageAssembler(maxMessageSize uint64) *MessageAssembler {
+	return &MessageAssembler{
+		maxMessageSize: maxMessageSize,
+		isAssembling:   false,
+	}
+}
+
+// EnableCompression decompresses messages sent with permessage-deflate.
+// The maximum message size applies to the decompressed payload as well.
+func (a *MessageAssembler) EnableCompression(deflate *Deflate) {
+	a.deflate = deflate
+}
+
+// Push feeds the next frame read off the wire. A message is returned once
+// the frame completes one, otherwise the message is nil.
+func (a *MessageAssembler) Push(frame *Frame) (*Message, error) {
+	// Control frames MAY be injected in the middle of a fragmented
+	// message. Control frames themselves MUST NOT be fragmented.
+	if frame.IsControl() {
+		if !frame.header.Fin {
+			return nil, ErrFragmentedControlFrame
+		}
+
+		return &Message{OpCode: frame.OpCode(), Data: frame.Data}, nil
+	}
+
+	if frame.IsCompressed() && a.deflate == nil {
+		return nil, ErrReservedBitsSet
+	}
+
+	switch {
+	case frame.IsStartFragment():
+		if a.isAssembling {
+			return nil, ErrExpectedContinuation
+		}
+
+		a.start(frame)
+		return nil, a.append(frame.Data)
+	case frame.IsContinuationFragment():
+		if !a.isAssembling {
+			return nil, ErrUnexpectedContinuation
+		}
+
+		return nil, a.append(frame.Data)
+	case frame.IsEndFragment():
+		if !a.isAssembling {
+			return nil, ErrUnexpectedContinuation
+		}
+
+		err := a.append(frame.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		return a.finish()
+	}
+
+	// Unfragmented message
+	if a.isAssembling {
+		return nil, ErrExpectedContinuation
+	}
+
+	a.start(frame)
+	err := a.append(frame.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.finish()
+}
+
+func (a *MessageAssembler) start(frame *Frame) {
+	a.isAssembling = true
+	a.opCode = frame.OpCode()
+	a.isCompressed = frame.IsCompressed()
+}
+
+func (a *MessageAssembler) append(data []uint8) error {
+	if uint64(len(a.fragments))+uint64(len(data)) > a.maxMessageSize {
+		a.reset()
+		return ErrMessageTooLarge
+	}
+
+	// Text is validated as fragments arrive so an invalid message fails
+	// before the whole of it is received. Compressed text can only be
+	// validated once decompressed.
+	if a.opCode == OpTextFrame && !a.isCompressed {
+		err := a.validator.Validate(data)
+		if err != nil {
+			a.reset()
+			return err
+		}
+	}
+
+	a.fragments = append(a.fragments, data...)
+	return nil
+}
+
+func (a *MessageAssembler) finish() (*Message, error) {
+	defer a.reset()
+
+	data := a.fragments
+	if a.isCompressed {
+		decompressed, err := a.deflate.Decompress(data, a.maxMessageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		data = decompressed
+		if a.opCode == OpTextFrame {
+			err = a.validator.Validate(data)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// The text message must not end in the middle of a UTF-8 sequence.
+	if a.opCode == OpTextFrame {
+		err := a.validator.Finish()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Empty messages carry an empty, not a nil, payload.
+	if data == nil {
+		data = []uint8{}
+	}
+
+	return &Message{OpCode: a.opCode, Data: data}, nil
+}
+
+func (a *MessageAssembler) reset() {
+	a.isAssembling = false
+	a.opCode = OpContinuationFrame
+	a.isCompressed = false
+	a.fragments = nil
+	a.validator.Reset()
+}
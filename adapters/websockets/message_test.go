@@ -0,0 +1,162 @@
+package websockets
+
+import (
+	"errors"
+	"testing"
+)
+
+func testFrame(fin bool, opCode FrameOpCode, data string) *Frame {
+	frame := NewFrame(opCode, []uint8(data))
+	frame.header.Fin = fin
+	return frame
+}
+
+func TestMessageAssembler(t *testing.T) {
+	cases := []struct {
+		description  string
+		frames       []*Frame
+		wantMessages []Message
+		wantErr      error
+	}{
+		{
+			description:  "unfragmented message",
+			frames:       []*Frame{testFrame(true, OpTextFrame, "Hello")},
+			wantMessages: []Message{{OpCode: OpTextFrame, Data: []uint8("Hello")}},
+		},
+		{
+			description: "fragmented message",
+			frames: []*Frame{
+				testFrame(false, OpTextFrame, "Hel"),
+				testFrame(false, OpContinuationFrame, "lo, "),
+				testFrame(true, OpContinuationFrame, "World!"),
+			},
+			wantMessages: []Message{{OpCode: OpTextFrame, Data: []uint8("Hello, World!")}},
+		},
+		{
+			description: "control frame between fragments",
+			frames: []*Frame{
+				testFrame(false, OpBinaryFrame, "Hel"),
+				testFrame(true, OpPing, "ping"),
+				testFrame(true, OpContinuationFrame, "lo"),
+				testFrame(true, OpTextFrame, "next"),
+			},
+			wantMessages: []Message{
+				{OpCode: OpPing, Data: []uint8("ping")},
+				{OpCode: OpBinaryFrame, Data: []uint8("Hello")},
+				{OpCode: OpTextFrame, Data: []uint8("next")},
+			},
+		},
+		{
+			description: "continuation without a start",
+			frames:      []*Frame{testFrame(true, OpContinuationFrame, "lo")},
+			wantErr:     ErrUnexpectedContinuation,
+		},
+		{
+			description: "middle continuation without a start",
+			frames:      []*Frame{testFrame(false, OpContinuationFrame, "lo")},
+			wantErr:     ErrUnexpectedContinuation,
+		},
+		{
+			description: "new message before the end fragment",
+			frames: []*Frame{
+				testFrame(false, OpTextFrame, "Hel"),
+				testFrame(true, OpTextFrame, "lo"),
+			},
+			wantErr: ErrExpectedContinuation,
+		},
+		{
+			description: "new fragmented message before the end fragment",
+			frames: []*Frame{
+				testFrame(false, OpTextFrame, "Hel"),
+				testFrame(false, OpTextFrame, "lo"),
+			},
+			wantErr: ErrExpectedContinuation,
+		},
+		{
+			description: "invalid UTF-8 text",
+			frames:      []*Frame{testFrame(true, OpTextFrame, "\xC0\xAF")},
+			wantErr:     ErrInvalidUTF8,
+		},
+		{
+			description: "UTF-8 sequence split across fragments",
+			frames: []*Frame{
+				testFrame(false, OpTextFrame, "\xE2\x82"),
+				testFrame(true, OpContinuationFrame, "\xAC"),
+			},
+			wantMessages: []Message{{OpCode: OpTextFrame, Data: []uint8("€")}},
+		},
+		{
+			description: "invalid UTF-8 fails on the offending fragment",
+			frames: []*Frame{
+				testFrame(false, OpTextFrame, "\xED"),
+				testFrame(false, OpContinuationFrame, "\xA0"),
+			},
+			wantErr: ErrInvalidUTF8,
+		},
+		{
+			description: "text ending in the middle of a UTF-8 sequence",
+			frames: []*Frame{
+				testFrame(false, OpTextFrame, "a"),
+				testFrame(true, OpContinuationFrame, "\xE2\x82"),
+			},
+			wantErr: ErrInvalidUTF8,
+		},
+		{
+			description:  "binary messages aren't validated",
+			frames:       []*Frame{testFrame(true, OpBinaryFrame, "\xC0\xAF")},
+			wantMessages: []Message{{OpCode: OpBinaryFrame, Data: []uint8("\xC0\xAF")}},
+		},
+		{
+			description: "fragmented control frame",
+			frames:      []*Frame{testFrame(false, OpPing, "ping")},
+			wantErr:     ErrFragmentedControlFrame,
+		},
+		{
+			description: "unfragmented message too large",
+			frames:      []*Frame{testFrame(true, OpTextFrame, "Hello, World! Hello")},
+			wantErr:     ErrMessageTooLarge,
+		},
+		{
+			description: "fragmented message too large",
+			frames: []*Frame{
+				testFrame(false, OpTextFrame, "Hello, World!"),
+				testFrame(true, OpContinuationFrame, " Hello"),
+			},
+			wantErr: ErrMessageTooLarge,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			assembler := NewMessageAssembler(16)
+			messages := []Message{}
+
+			var err error
+			for _, frame := range c.frames {
+				var message *Message
+				message, err = assembler.Push(frame)
+				if err != nil {
+					break
+				}
+
+				if message != nil {
+					messages = append(messages, *message)
+				}
+			}
+
+			if !errors.Is(err, c.wantErr) {
+				t.Fatalf("Expected error [%v] found [%v]", c.wantErr, err)
+			}
+
+			if len(messages) != len(c.wantMessages) {
+				t.Fatalf("Expected [%d] messages found [%d]", len(c.wantMessages), len(messages))
+			}
+
+			for i, want := range c.wantMessages {
+				if messages[i].OpCode != want.OpCode || string(messages[i].Data) != string(want.Data) {
+					t.Errorf("Message [%d]: expected [%v %s] found [%v %s]", i, want.OpCode, want.Data, messages[i].OpCode, messages[i].Data)
+				}
+			}
+		})
+	}
+}
@@ -1,8 +1,12 @@
 package websockets
 
+import "errors"
+
+var ErrTruncatedFrame = errors.New("Frame is shorter than its header claims")
+
 type FrameParser struct {
 	raw     []byte
-	pointer uint8
+	pointer int
 }
 
 func newParser(raw []byte) *FrameParser {
@@ -12,26 +16,57 @@ func newParser(raw []byte) *FrameParser {
 	}
 }
 
-func (p *FrameParser) parseFrame() Frame {
-	header := p.parseHeader()
+// parseFrame reads the header and takes the payload length
+// bytes following it as the frame data.
+func (p *FrameParser) parseFrame() (Frame, error) {
+	header, err := p.parseHeader()
+	if err != nil {
+		return Frame{}, err
+	}
+
+	if uint64(len(p.raw)-p.pointer) < header.PayloadLength {
+		return Frame{}, ErrTruncatedFrame
+	}
 
 	frame := Frame{
+		raw:    p.raw,
 		header: header,
-		Data:   p.raw[p.pointer:],
+		Data:   p.raw[p.pointer : p.pointer+int(header.PayloadLength)],
 	}
 
-	return frame
+	return frame, nil
 }
 
-func (p *FrameParser) parseHeader() websocketHeader {
-	fin := parseBit(p.getCurrentByte(), 0)
-	opCode := parseHeaderOpCode(p.getCurrentByte())
+func (p *FrameParser) parseHeader() (websocketHeader, error) {
+	current, err := p.getCurrentByte()
+	if err != nil {
+		return websocketHeader{}, err
+	}
+
+	fin := parseBit(current, 0)
+	rsv1 := parseBit(current, 1)
+	rsv2 := parseBit(current, 2)
+	rsv3 := parseBit(current, 3)
+	opCode := parseHeaderOpCode(current)
 
 	p.Advance(1)
 
-	isMasked := parseBit(p.getCurrentByte(), 0)
-	mode := parseHeaderPayloadLengthMode(p.getCurrentByte())
-	length := p.parseHeaderPayloadLength(mode)
+	current, err = p.getCurrentByte()
+	if err != nil {
+		return websocketHeader{}, err
+	}
+
+	isMasked := parseBit(current, 0)
+	mode, err := parseHeaderPayloadLengthMode(current)
+	if err != nil {
+		return websocketHeader{}, err
+	}
+
+	length, err := p.parseHeaderPayloadLength(mode)
+	if err != nil {
+		return websocketHeader{}, err
+	}
+
 	// Payload length:  7 bits, 7+16 bits, or 7+64 bits
 	switch mode {
 	case Simple:
@@ -44,6 +79,9 @@ func (p *FrameParser) parseHeader() websocketHeader {
 
 	header := websocketHeader{
 		Fin:           fin,
+		Rsv1:          rsv1,
+		Rsv2:          rsv2,
+		Rsv3:          rsv3,
 		OpCode:        opCode,
 		IsMasked:      isMasked,
 		PayloadLength: length,
@@ -55,12 +93,15 @@ func (p *FrameParser) parseHeader() websocketHeader {
 	//                     ; present only if frame-masked is 1
 	//                     ; 32 bits in length
 	if isMasked {
-		mask := p.raw[p.pointer : p.pointer+4]
+		mask, err := p.take(4)
+		if err != nil {
+			return websocketHeader{}, err
+		}
 		header.Mask = [4]byte(mask)
 		p.Advance(4)
 	}
 
-	return header
+	return header, nil
 }
 
 func parseHeaderOpCode(input uint8) FrameOpCode {
@@ -76,10 +117,24 @@ func parseBit(input uint8, index int) bool {
 	return false
 }
 
-func (p *FrameParser) getCurrentByte() uint8 {
-	return p.raw[p.pointer]
+func (p *FrameParser) getCurrentByte() (uint8, error) {
+	if p.pointer >= len(p.raw) {
+		return 0, ErrTruncatedFrame
+	}
+
+	return p.raw[p.pointer], nil
+}
+
+// take returns the n bytes starting at the current byte
+// without advancing the pointer.
+func (p *FrameParser) take(n int) ([]uint8, error) {
+	if len(p.raw)-p.pointer < n {
+		return nil, ErrTruncatedFrame
+	}
+
+	return p.raw[p.pointer : p.pointer+n], nil
 }
 
-func (p *FrameParser) Advance(by byte) {
+func (p *FrameParser) Advance(by int) {
 	p.pointer += by
 }
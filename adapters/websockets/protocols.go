@@ -0,0 +1,33 @@
+package websockets
+
+import "strings"
+
+// ParseProtocols splits a Sec-WebSocket-Protocol header into the
+// subprotocols a client offered, most preferred first.
+// https://datatracker.ietf.org/doc/html/rfc6455#section-11.3.4
+func ParseProtocols(header string) []string {
+	protocols := []string{}
+	for _, value := range strings.Split(header, ",") {
+		protocol := strings.TrimSpace(value)
+		if protocol != "" {
+			protocols = append(protocols, protocol)
+		}
+	}
+
+	return protocols
+}
+
+// NegotiateProtocol picks the first offered subprotocol that's supported,
+// the client's preference wins over the order of the supported list.
+// Subprotocol names are case-sensitive.
+func NegotiateProtocol(offered []string, supported []string) (string, bool) {
+	for _, protocol := range offered {
+		for _, candidate := range supported {
+			if protocol == candidate {
+				return protocol, true
+			}
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,66 @@
+package websockets
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseProtocols(t *testing.T) {
+	cases := []struct {
+		input  string
+		output []string
+	}{
+		{input: "", output: []string{}},
+		{input: "nony.v1.json", output: []string{"nony.v1.json"}},
+		{input: "nony.v2.msgpack,  nony.v1.json ,", output: []string{"nony.v2.msgpack", "nony.v1.json"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			actual := ParseProtocols(c.input)
+			if !slices.Equal(actual, c.output) {
+				t.Errorf("Expected %v found %v", c.output, actual)
+			}
+		})
+	}
+}
+
+func TestNegotiateProtocol(t *testing.T) {
+	supported := []string{"nony.v1.json", "nony.v2.msgpack"}
+	cases := []struct {
+		description string
+		offered     []string
+		protocol    string
+		ok          bool
+	}{
+		{
+			description: "Client preference wins",
+			offered:     []string{"nony.v2.msgpack", "nony.v1.json"},
+			protocol:    "nony.v2.msgpack",
+			ok:          true,
+		},
+		{
+			description: "Unsupported protocols are skipped",
+			offered:     []string{"token.abc", "nony.v3.cbor", "nony.v1.json"},
+			protocol:    "nony.v1.json",
+			ok:          true,
+		},
+		{
+			description: "Names are case-sensitive",
+			offered:     []string{"NONY.V1.JSON"},
+		},
+		{
+			description: "Nothing offered",
+			offered:     []string{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			protocol, ok := NegotiateProtocol(c.offered, supported)
+			if protocol != c.protocol || ok != c.ok {
+				t.Errorf("Expected [%s %t] found [%s %t]", c.protocol, c.ok, protocol, ok)
+			}
+		})
+	}
+}
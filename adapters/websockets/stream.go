@@ -0,0 +1,267 @@
+package websockets
+
+import (
+	"errors"
+	"io"
+)
+
+var ErrInvalidChunkSize = errors.New("Chunk size must be positive")
+
+// FrameSource hands out frames one at a time, their payload as a stream
+// that must be read whole before the next frame, e.g. the frames a
+// FrameDecoder cuts out of a connection.
+type FrameSource interface {
+	NextFrame() (*Frame, io.Reader, error)
+}
+
+// ControlHandler handles control frames read while looking for the next
+// data message or in the middle of streaming one. An error returned by the
+// handler is returned by the message stream.
+type ControlHandler func(message *Message) error
+
+// NextMessage reads the frames of the source up to the start of the next
+// data message and returns its payload as a stream, fragments are read as
+// the stream is consumed. Text is validated as UTF-8 and compressed
+// messages are decompressed if deflate isn't nil. The previous message
+// must have been read whole.
+func NextMessage(source FrameSource, onControl ControlHandler, deflate *Deflate) (FrameOpCode, io.Reader, error) {
+	for {
+		frame, payload, err := source.NextFrame()
+		if err != nil {
+			return OpContinuationFrame, nil, err
+		}
+
+		if frame.IsControl() {
+			err = handleControlFrame(frame, payload, onControl)
+			if err != nil {
+				return OpContinuationFrame, nil, err
+			}
+			continue
+		}
+
+		if frame.OpCode() == OpContinuationFrame {
+			return OpContinuationFrame, nil, ErrUnexpectedContinuation
+		}
+
+		if frame.IsCompressed() && deflate == nil {
+			return OpContinuationFrame, nil, ErrReservedBitsSet
+		}
+
+		var message io.Reader = &messageReader{
+			source:    source,
+			onControl: onControl,
+			payload:   payload,
+			isFinal:   frame.header.Fin,
+		}
+
+		if frame.IsCompressed() {
+			message, err = deflate.NewReader(message)
+			if err != nil {
+				return OpContinuationFrame, nil, err
+			}
+		}
+
+		if frame.OpCode() == OpTextFrame {
+			message = &utf8Reader{reader: message}
+		}
+
+		return frame.OpCode(), message, nil
+	}
+}
+
+func handleControlFrame(frame *Frame, payload io.Reader, onControl ControlHandler) error {
+	// Control frames are at most 125 bytes, reading them whole is fine.
+	data, err := io.ReadAll(payload)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	return onControl(&Message{OpCode: frame.OpCode(), Data: data})
+}
+
+// messageReader streams the payload of a data message across its fragments.
+type messageReader struct {
+	source    FrameSource
+	onControl ControlHandler
+
+	payload io.Reader
+	isFinal bool
+	err     error
+}
+
+func (m *messageReader) Read(buffer []uint8) (int, error) {
+	for m.err == nil {
+		n, err := m.payload.Read(buffer)
+		if err != nil && err != io.EOF {
+			m.err = err
+		}
+
+		if n > 0 || m.err != nil {
+			return n, m.err
+		}
+
+		if err != io.EOF {
+			continue
+		}
+
+		if m.isFinal {
+			m.err = io.EOF
+			break
+		}
+
+		m.err = m.nextFragment()
+	}
+
+	return 0, m.err
+}
+
+// nextFragment moves to the payload of the next continuation frame,
+// control frames may be injected before it.
+func (m *messageReader) nextFragment() error {
+	for {
+		frame, payload, err := m.source.NextFrame()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+
+		if frame.IsControl() {
+			err = handleControlFrame(frame, payload, m.onControl)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if frame.OpCode() != OpContinuationFrame {
+			return ErrExpectedContinuation
+		}
+
+		m.payload = payload
+		m.isFinal = frame.header.Fin
+		return nil
+	}
+}
+
+// utf8Reader validates text as it's read.
+type utf8Reader struct {
+	reader    io.Reader
+	validator UTF8Validator
+}
+
+func (u *utf8Reader) Read(buffer []uint8) (int, error) {
+	n, err := u.reader.Read(buffer)
+
+	validationErr := u.validator.Validate(buffer[:n])
+	if validationErr == nil && err == io.EOF {
+		validationErr = u.validator.Finish()
+	}
+
+	if validationErr != nil {
+		return 0, validationErr
+	}
+
+	return n, err
+}
+
+// messageWriter sends a message in frames of up to chunkSize bytes as it's
+// written. The final frame is sent on Close.
+type messageWriter struct {
+	opCode    FrameOpCode
+	chunkSize int
+	deflate   *Deflate
+	send      func(frame *Frame) error
+
+	buffer      []uint8
+	isFirstSent bool
+	isClosed    bool
+	err         error
+}
+
+// NewMessageWriter streams a data message through send. The message is
+// compressed if deflate isn't nil.
+func NewMessageWriter(opCode FrameOpCode, chunkSize int, deflate *Deflate, send func(frame *Frame) error) (io.WriteCloser, error) {
+	if chunkSize <= 0 {
+		return nil, ErrInvalidChunkSize
+	}
+
+	if deflate != nil {
+		err := deflate.beginCompression()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &messageWriter{
+		opCode:    opCode,
+		chunkSize: chunkSize,
+		deflate:   deflate,
+		send:      send,
+	}, nil
+}
+
+func (m *messageWriter) Write(data []uint8) (int, error) {
+	if m.isClosed {
+		return 0, io.ErrClosedPipe
+	}
+
+	if m.err != nil {
+		return 0, m.err
+	}
+
+	if m.deflate != nil {
+		_, m.err = m.deflate.writer.Write(data)
+		if m.err != nil {
+			return 0, m.err
+		}
+
+		if m.deflate.output.Len() > m.chunkSize {
+			m.err = m.sendFrame(m.deflate.takeCompressed(), false)
+		}
+		return len(data), m.err
+	}
+
+	m.buffer = append(m.buffer, data...)
+	for len(m.buffer) >= m.chunkSize && m.err == nil {
+		m.err = m.sendFrame(m.buffer[:m.chunkSize], false)
+		m.buffer = m.buffer[m.chunkSize:]
+	}
+
+	return len(data), m.err
+}
+
+// Close sends the final frame of the message.
+func (m *messageWriter) Close() error {
+	if m.isClosed {
+		return nil
+	}
+	m.isClosed = true
+
+	if m.err != nil {
+		return m.err
+	}
+
+	if m.deflate != nil {
+		compressed, err := m.deflate.endCompression()
+		if err != nil {
+			return err
+		}
+		m.buffer = compressed
+	}
+
+	return m.sendFrame(m.buffer, true)
+}
+
+func (m *messageWriter) sendFrame(data []uint8, isFinal bool) error {
+	opCode := OpContinuationFrame
+	if !m.isFirstSent {
+		opCode = m.opCode
+	}
+
+	frame := NewFrame(opCode, data)
+	frame.header.Fin = isFinal
+	// Only the first frame of a message has the compressed bit set.
+	frame.header.Rsv1 = m.deflate != nil && !m.isFirstSent
+	m.isFirstSent = true
+
+	return m.send(frame)
+}
@@ -0,0 +1,220 @@
+package websockets
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// maskingSender collects the frames a client would send.
+type maskingSender struct {
+	stream bytes.Buffer
+	frames int
+}
+
+func (s *maskingSender) send(frame *Frame) error {
+	frame.setMask([4]uint8{0x11, 0x22, 0x33, 0x44})
+	s.stream.Write(frame.Encode())
+	s.frames++
+	return nil
+}
+
+// decoderSource streams the frames of a byte stream.
+type decoderSource struct {
+	decoder *FrameDecoder
+	stream  io.Reader
+}
+
+func newDecoderSource(stream io.Reader) *decoderSource {
+	decoder := NewFrameDecoder()
+	decoder.EnableCompression()
+	return &decoderSource{decoder: decoder, stream: stream}
+}
+
+func (s *decoderSource) NextFrame() (*Frame, io.Reader, error) {
+	return s.decoder.NextFrame(s.stream)
+}
+
+func writeMessage(t *testing.T, sender *maskingSender, opCode FrameOpCode, deflate *Deflate, data []uint8) {
+	writer, err := NewMessageWriter(opCode, 100, deflate, sender.send)
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+
+	// Uneven writes so chunks don't line up with them.
+	for len(data) > 0 {
+		n := min(37, len(data))
+		_, err = writer.Write(data[:n])
+		if err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		data = data[n:]
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+}
+
+func TestMessageStream(t *testing.T) {
+	text := bytes.Repeat([]uint8("Hello, κόσμε! "), 100)
+	binary := make([]uint8, 5000)
+	for i := range binary {
+		binary[i] = uint8(i)
+	}
+
+	cases := []struct {
+		description  string
+		sendDeflate  *Deflate
+		readDeflate  *Deflate
+		isCompressed bool
+	}{
+		{
+			description: "uncompressed",
+		},
+		{
+			description: "compressed",
+			sendDeflate: NewClientDeflate(DeflateParams{}),
+			readDeflate: NewServerDeflate(DeflateParams{}),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			sender := &maskingSender{}
+			writeMessage(t, sender, OpTextFrame, c.sendDeflate, text)
+			sender.send(NewFrame(OpPing, []uint8("ping")))
+			writeMessage(t, sender, OpBinaryFrame, c.sendDeflate, binary)
+			writeMessage(t, sender, OpTextFrame, c.sendDeflate, text)
+
+			if c.sendDeflate == nil && sender.frames < 2*len(text)/100 {
+				t.Errorf("Expected messages to be sent in chunks, found [%d] frames", sender.frames)
+			}
+
+			source := newDecoderSource(&sender.stream)
+			pings := 0
+			onControl := func(message *Message) error {
+				pings++
+				return nil
+			}
+
+			for _, want := range []struct {
+				opCode FrameOpCode
+				data   []uint8
+			}{{OpTextFrame, text}, {OpBinaryFrame, binary}, {OpTextFrame, text}} {
+				opCode, message, err := NextMessage(source, onControl, c.readDeflate)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				data, err := io.ReadAll(message)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				if opCode != want.opCode || !bytes.Equal(data, want.data) {
+					t.Errorf("Expected [%v] message of length [%d] found [%v] of length [%d]", want.opCode, len(want.data), opCode, len(data))
+				}
+			}
+
+			if pings != 1 {
+				t.Errorf("Expected [1] ping found [%d]", pings)
+			}
+		})
+	}
+}
+
+func TestMessageStreamInjectedControlFrame(t *testing.T) {
+	stream := []uint8{}
+	stream = append(stream, maskedFrame(false, OpBinaryFrame, []uint8("Hel"))...)
+	stream = append(stream, maskedFrame(true, OpPing, []uint8("ping"))...)
+	stream = append(stream, maskedFrame(true, OpContinuationFrame, []uint8("lo"))...)
+
+	control := []string{}
+	_, message, err := NextMessage(newDecoderSource(bytes.NewReader(stream)), func(message *Message) error {
+		control = append(control, string(message.Data))
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, err := io.ReadAll(message)
+	if err != nil || string(data) != "Hello" {
+		t.Errorf("Expected [Hello] found [%s] with error [%v]", data, err)
+	}
+
+	if len(control) != 1 || control[0] != "ping" {
+		t.Errorf("Expected the ping between fragments found %v", control)
+	}
+}
+
+func TestMessageStreamErrors(t *testing.T) {
+	closeErr := &CloseError{Code: CloseGoingAway}
+
+	cases := []struct {
+		description string
+		frames      [][]uint8
+		wantErr     error
+	}{
+		{
+			description: "invalid UTF-8 in a later fragment",
+			frames: [][]uint8{
+				maskedFrame(false, OpTextFrame, []uint8("Hello")),
+				maskedFrame(true, OpContinuationFrame, []uint8{0xC0, 0xAF}),
+			},
+			wantErr: ErrInvalidUTF8,
+		},
+		{
+			description: "new message before the end fragment",
+			frames: [][]uint8{
+				maskedFrame(false, OpTextFrame, []uint8("Hel")),
+				maskedFrame(true, OpTextFrame, []uint8("lo")),
+			},
+			wantErr: ErrExpectedContinuation,
+		},
+		{
+			description: "stream cut in the middle of a message",
+			frames: [][]uint8{
+				maskedFrame(false, OpTextFrame, []uint8("Hel")),
+			},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			description: "close in the middle of a message",
+			frames: [][]uint8{
+				maskedFrame(false, OpTextFrame, []uint8("Hel")),
+				maskedFrame(true, OpConnectionClose, []uint8{0x03, 0xE9}),
+			},
+			wantErr: closeErr,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			source := newDecoderSource(bytes.NewReader(bytes.Join(c.frames, nil)))
+			_, message, err := NextMessage(source, func(message *Message) error {
+				return closeErr
+			}, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			_, err = io.ReadAll(message)
+			if !errors.Is(err, c.wantErr) {
+				t.Errorf("Expected [%v] found [%v]", c.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestMessageWriterChunkSize(t *testing.T) {
+	for _, chunkSize := range []int{0, -1} {
+		_, err := NewMessageWriter(OpTextFrame, chunkSize, nil, func(frame *Frame) error { return nil })
+		if !errors.Is(err, ErrInvalidChunkSize) {
+			t.Errorf("Expected [%v] for chunk size [%d] found [%v]", ErrInvalidChunkSize, chunkSize, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package websockets
+
+import "errors"
+
+var ErrInvalidUTF8 = errors.New("Text message payload isn't valid UTF-8")
+
+// UTF8Validator validates UTF-8 text handed to it in chunks, a multi byte
+// sequence may be split across chunks (i.e. across fragments).
+// https://datatracker.ietf.org/doc/html/rfc6455#section-8.1
+// When an endpoint is to interpret a byte stream as UTF-8 but finds
+// that the byte stream is not, in fact, a valid UTF-8 stream, that
+// endpoint MUST _Fail the WebSocket Connection_.
+//
+// Bytes are checked one at a time against the well-formed byte sequences
+// table (Unicode 15, Table 3-7) so an invalid byte is reported as soon as
+// it's seen instead of when the message is complete.
+type UTF8Validator struct {
+	// Continuation bytes still expected for the current sequence.
+	remaining int
+	// Range the next continuation byte must fall in, the second byte of
+	// some sequences has a narrower range to rule out overlong encodings,
+	// surrogates and code points above U+10FFFF.
+	lower uint8
+	upper uint8
+}
+
+// Validate checks the next chunk of text.
+func (v *UTF8Validator) Validate(chunk []uint8) error {
+	for _, b := range chunk {
+		if v.remaining > 0 {
+			if b < v.lower || b > v.upper {
+				return ErrInvalidUTF8
+			}
+
+			v.remaining--
+			v.lower, v.upper = 0x80, 0xBF
+			continue
+		}
+
+		switch {
+		case b <= 0x7F:
+			continue
+		case b >= 0xC2 && b <= 0xDF:
+			v.expect(1, 0x80, 0xBF)
+		case b == 0xE0:
+			v.expect(2, 0xA0, 0xBF)
+		case b >= 0xE1 && b <= 0xEC, b == 0xEE, b == 0xEF:
+			v.expect(2, 0x80, 0xBF)
+		case b == 0xED:
+			v.expect(2, 0x80, 0x9F)
+		case b == 0xF0:
+			v.expect(3, 0x90, 0xBF)
+		case b >= 0xF1 && b <= 0xF3:
+			v.expect(3, 0x80, 0xBF)
+		case b == 0xF4:
+			v.expect(3, 0x80, 0x8F)
+		default:
+			return ErrInvalidUTF8
+		}
+	}
+
+	return nil
+}
+
+// Finish reports text that ends in the middle of a sequence,
+// the validator is ready for the next message afterwards.
+func (v *UTF8Validator) Finish() error {
+	isComplete := v.remaining == 0
+	v.Reset()
+
+	if !isComplete {
+		return ErrInvalidUTF8
+	}
+
+	return nil
+}
+
+func (v *UTF8Validator) Reset() {
+	v.remaining = 0
+}
+
+func (v *UTF8Validator) expect(remaining int, lower uint8, upper uint8) {
+	v.remaining = remaining
+	v.lower = lower
+	v.upper = upper
+}
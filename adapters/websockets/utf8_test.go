@@ -0,0 +1,101 @@
+package websockets
+
+import (
+	"testing"
+)
+
+func TestUTF8Validator(t *testing.T) {
+	cases := []struct {
+		description string
+		input       []uint8
+		valid       bool
+	}{
+		{
+			description: "ASCII",
+			input:       []uint8("Hello, World!"),
+			valid:       true,
+		},
+		{
+			description: "multi byte sequences",
+			input:       []uint8("κόσμε ハロー 👋"),
+			valid:       true,
+		},
+		{
+			description: "boundary code points",
+			input:       []uint8("\u0080߿ࠀ퟿￿\U00010000\U0010FFFF"),
+			valid:       true,
+		},
+		{
+			description: "stray continuation byte",
+			input:       []uint8{'a', 0x80},
+		},
+		{
+			description: "overlong 2 byte encoding",
+			input:       []uint8{0xC0, 0xAF},
+		},
+		{
+			description: "overlong 3 byte encoding",
+			input:       []uint8{0xE0, 0x80, 0xAF},
+		},
+		{
+			description: "overlong 4 byte encoding",
+			input:       []uint8{0xF0, 0x80, 0x80, 0xAF},
+		},
+		{
+			description: "surrogate",
+			input:       []uint8{0xED, 0xA0, 0x80},
+		},
+		{
+			description: "code point above U+10FFFF",
+			input:       []uint8{0xF4, 0x90, 0x80, 0x80},
+		},
+		{
+			description: "invalid leading byte",
+			input:       []uint8{0xF5, 0x80, 0x80, 0x80},
+		},
+		{
+			description: "sequence cut short by ASCII",
+			input:       []uint8{0xE2, 0x82, 'a'},
+		},
+		{
+			description: "incomplete sequence at the end",
+			input:       []uint8{'a', 0xE2, 0x82},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			// Every split point must give the same result as validating
+			// the whole input at once.
+			for split := 0; split <= len(c.input); split++ {
+				validator := UTF8Validator{}
+
+				err := validator.Validate(c.input[:split])
+				if err == nil {
+					err = validator.Validate(c.input[split:])
+				}
+				if err == nil {
+					err = validator.Finish()
+				}
+
+				if (err == nil) != c.valid {
+					t.Errorf("Split at [%d]: expected valid [%v] found error [%v]", split, c.valid, err)
+				}
+			}
+		})
+	}
+}
+
+func TestUTF8ValidatorFailsFast(t *testing.T) {
+	validator := UTF8Validator{}
+
+	err := validator.Validate([]uint8{'a', 0xED})
+	if err != nil {
+		t.Fatalf("Unexpected error for a valid prefix: %v", err)
+	}
+
+	err = validator.Validate([]uint8{0xA0})
+	if err != ErrInvalidUTF8 {
+		t.Errorf("Expected [%v] on the first invalid byte found [%v]", ErrInvalidUTF8, err)
+	}
+}
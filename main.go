@@ -1,17 +1,58 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/shakram02/nony-chat/adapters/auth"
+	"github.com/shakram02/nony-chat/adapters/certs"
+	"github.com/shakram02/nony-chat/adapters/chat"
+	"github.com/shakram02/nony-chat/adapters/http/handshaker"
+	"github.com/shakram02/nony-chat/adapters/http/mux"
+	http_parser "github.com/shakram02/nony-chat/adapters/http/parser"
+	"github.com/shakram02/nony-chat/adapters/metrics"
 	"github.com/shakram02/nony-chat/adapters/nony"
 	"github.com/shakram02/nony-chat/adapters/protocol/transport"
+	"github.com/shakram02/nony-chat/adapters/proxy"
 )
 
 const BufferSize = 2048
+const MaxMessageSize = 1 << 20
+
+var (
+	certFile   = flag.String("tls-cert", "", "TLS certificate file, reloaded when it changes")
+	keyFile    = flag.String("tls-key", "", "TLS private key file")
+	selfSigned = flag.Bool("tls-self-signed", false, "Serve TLS with a certificate generated for localhost")
+	authSecret = flag.String("auth-secret", "", "Secret signing client tokens, clients must send a token when set")
+	issueToken = flag.String("issue-token", "", "Print a token for the given user, signed with -auth-secret, and exit")
+	tokenTtl   = flag.Duration("token-ttl", 24*time.Hour, "How long issued tokens are valid")
+
+	allowedOrigins = flag.String("allowed-origins", "", "Comma separated hosts of the pages allowed to connect besides the server's own, e.g. chat.example.com or *.example.com")
+
+	trustedProxies = flag.String("trusted-proxies", "", "Comma separated IPs or CIDRs of proxies trusted to relay client addresses")
+	proxyProtocol  = flag.Bool("proxy-protocol", false, "Read PROXY protocol headers sent by trusted proxies")
+
+	handshakeTimeout     = flag.Duration("handshake-timeout", 10*time.Second, "How long clients may take to send their handshake")
+	maxHeaderSize        = flag.Int("max-header-size", http_parser.DefaultMaxHeaderSize, "Largest handshake headers accepted, in bytes")
+	maxPendingHandshakes = flag.Int("max-pending-handshakes", 1024, "Handshakes in progress at once, more clients are turned away")
+	metricsAddr          = flag.String("metrics-addr", "", "Address serving the handshake counters as JSON, e.g. 127.0.0.1:9100, disabled when empty")
+
+	lineAddr        = flag.String("line-addr", "", "Address serving a JSON packet a line over plain TCP, e.g. for nc, disabled when empty. With -auth-secret, clients send their token on the first line")
+	lineIdleTimeout = flag.Duration("line-idle-timeout", 10*time.Minute, "How long line clients may stay silent before they're dropped")
+	maxLineClients  = flag.Int("max-line-clients", 1024, "Line clients served at once, more are turned away")
+)
 
 var ErrInvalidFrame = errors.New("Invalid websocket packet")
 
@@ -21,50 +62,223 @@ type ChatClient struct {
 }
 
 func main() {
-	http.Handle("/", http.FileServer(http.Dir("public")))
-	log.Println("HTTP ServerListening on port 8000")
-	go func() {
-		err := http.ListenAndServe(":8000", nil)
+	flag.Parse()
+
+	var signer *auth.Signer
+	if *authSecret != "" {
+		signer = auth.NewSigner([]byte(*authSecret))
+	}
+
+	if *issueToken != "" {
+		if signer == nil {
+			log.Fatalf("-issue-token requires -auth-secret")
+		}
+
+		token, err := signer.Sign(*issueToken, *tokenTtl)
 		if err != nil {
-			log.Fatalf("Failed to start HTTP server: %s", err)
+			log.Fatalf("Failed to issue token: %s", err)
 		}
-	}()
 
-	server, err := net.Listen("tcp", ":8080")
-	log.Println("TCP Server Listening on port 8080")
+		fmt.Println(token)
+		return
+	}
+
+	listener, err := net.Listen("tcp", ":8080")
 	if err != nil {
 		panic(fmt.Errorf("Failed to listen: %s", err))
 	}
 
+	trusted, err := proxy.ParseTrustedProxies(strings.Split(*trustedProxies, ","))
+	if err != nil {
+		panic(fmt.Errorf("Failed to parse trusted proxies: %s", err))
+	}
+
+	// The PROXY header comes before the TLS handshake.
+	if *proxyProtocol {
+		listener = proxy.NewListener(listener, trusted)
+	}
+
+	tlsConfig, err := makeTLSConfig()
+	if err != nil {
+		panic(fmt.Errorf("Failed to configure TLS: %s", err))
+	}
+
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+		log.Println("TLS Server Listening on port 8080")
+	} else {
+		log.Println("Server Listening on port 8080")
+	}
+
+	// Static assets and websockets share the port.
+	server := mux.NewMux(listener, mux.DefaultMaxHeadSize)
+	server.SetHeadTimeout(*handshakeTimeout)
+	server.SetMaxPending(*maxPendingHandshakes)
+	go func() {
+		handler := http.NewServeMux()
+		handler.Handle("/", http.FileServer(http.Dir("public")))
+
+		httpServer := &http.Server{
+			Handler:           handler,
+			ReadHeaderTimeout: *handshakeTimeout,
+			MaxHeaderBytes:    *maxHeaderSize,
+		}
+		err := httpServer.Serve(server.Plain())
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Fatalf("Failed to start HTTP server: %s", err)
+		}
+	}()
+	go server.Serve()
+
+	handshakeGate := transport.NewHandshakeGate(*maxPendingHandshakes)
+	originPolicy := &handshaker.OriginPolicy{
+		AllowedHosts:       splitList(*allowedOrigins),
+		AllowSameHost:      true,
+		AllowMissingOrigin: true,
+	}
+	rooms := chat.NewRooms()
+	chatServer := chat.NewServer(BufferSize, MaxMessageSize)
+	chatServer.Handle("/chats", rooms.HandleSocket)
+	chatServer.Handle("/chats/{roomId}", rooms.HandleSocket)
+	chatServer.SetSocketOptions(func(nonySocket *transport.NonySocket) {
+		nonySocket.SetOriginPolicy(originPolicy)
+		nonySocket.SetProtocols(nony.Protocols())
+		nonySocket.SetTrustedProxies(trusted)
+		nonySocket.SetHandshakeLimits(*handshakeTimeout, *maxHeaderSize)
+		nonySocket.SetHandshakeGate(handshakeGate)
+		if signer != nil {
+			nonySocket.SetAuthenticator(handshaker.NewTokenAuthenticator(signer))
+		}
+	})
+
+	// Interrupting the server cancels every connection, clients are
+	// told it's going away before it exits.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	// The counters are kept off the public port.
+	if *metricsAddr != "" {
+		metricsServer := &http.Server{Addr: *metricsAddr, Handler: metrics.Handler()}
+		log.Printf("Metrics Listening on %s", *metricsAddr)
+
+		go func() {
+			<-ctx.Done()
+			metricsServer.Close()
+		}()
+		go func() {
+			err := metricsServer.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("Failed to serve metrics: %s", err)
+			}
+		}()
+	}
+
+	connections := sync.WaitGroup{}
+	defer connections.Wait()
+
+	if *lineAddr != "" {
+		lineListener, err := net.Listen("tcp", *lineAddr)
+		if err != nil {
+			panic(fmt.Errorf("Failed to listen for line clients: %s", err))
+		}
+		log.Printf("Line Server Listening on %s", *lineAddr)
+
+		// Line clients log in like websocket clients handshake, they
+		// share the limits.
+		lineServer := chat.NewLineServer(rooms, BufferSize, MaxMessageSize)
+		lineServer.SetMaxClients(*maxLineClients)
+		lineServer.SetSocketOptions(func(lineSocket *transport.LineSocket) {
+			lineSocket.SetLoginLimits(*handshakeTimeout, handshakeGate)
+			lineSocket.SetIdleTimeout(*lineIdleTimeout)
+			if signer != nil {
+				lineSocket.SetSigner(signer)
+			}
+		})
+
+		go func() {
+			<-ctx.Done()
+			lineListener.Close()
+		}()
+		go serveLines(ctx, lineListener, lineServer, &connections)
+	}
+
 	for {
-		conn, err := server.Accept()
+		conn, err := server.Upgrades().Accept()
+		if errors.Is(err, net.ErrClosed) && ctx.Err() != nil {
+			log.Println("Shutting down")
+			return
+		}
+
 		if err != nil {
 			panic(fmt.Errorf("Failed to accept: %s", err))
 		}
 
+		connections.Add(1)
 		go func() {
-			tcpTransport := transport.NewTcp(conn, BufferSize)
-			websocketsTransport := transport.NewWebsocket(tcpTransport)
-			nonySocket := transport.NewNony(tcpTransport, websocketsTransport)
+			defer connections.Done()
+			chatServer.HandleConnection(ctx, conn)
+		}()
+	}
+}
 
-			err := nonySocket.Start()
-			if err != nil {
-				panic("failed to handshake client:" + err.Error())
-			}
+// splitList splits a comma separated flag, skipping empty items.
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
 
-			for {
-				packet, err := nonySocket.Read()
-				if err != nil {
-					panic("failed to read nony packet:" + err.Error())
-				}
+// makeTLSConfig returns nil when serving plaintext.
+func makeTLSConfig() (*tls.Config, error) {
+	if *selfSigned {
+		return certs.SelfSignedConfig()
+	}
 
-				if packet == nil {
-					nonySocket.Close()
-					break
-				}
+	if *certFile == "" && *keyFile == "" {
+		return nil, nil
+	}
 
-				fmt.Printf("[rx]: %v\n", packet.Content)
-			}
+	reloader, err := certs.NewReloader(*certFile, *keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return reloader.Config(), nil
+}
+
+// serveLines accepts line clients until the listener is closed.
+func serveLines(ctx context.Context, listener net.Listener, lineServer *chat.LineServer, connections *sync.WaitGroup) {
+	// Failures other than closing are retried with a growing delay,
+	// the way the mux retries them.
+	var delay time.Duration
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+
+		if err != nil {
+			delay = min(max(2*delay, 5*time.Millisecond), time.Second)
+			log.Printf("Failed to accept line client: %v, retrying in %v", err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+
+		connections.Add(1)
+		go func() {
+			defer connections.Done()
+			lineServer.HandleConnection(ctx, conn)
 		}()
 	}
 }
@@ -1,6 +1,14 @@
+// The page's ?user= and ?token= are used when the server requires tokens.
+const pageParams = new URLSearchParams(location.search);
+const userId = pageParams.get('user') || 'User';
+
 class ChatRoom {
     constructor() {
-        this.ws = new WebSocket('ws://localhost:8080/chats');
+        const socketUrl = new URL(`${location.protocol === 'https:' ? 'wss' : 'ws'}://${location.host}/chats`);
+        if (pageParams.get('token')) {
+            socketUrl.searchParams.set('token', pageParams.get('token'));
+        }
+        this.ws = new WebSocket(socketUrl, ['nony.v1.json']);
         this.messageList = document.getElementById('messageList');
         this.messageInput = document.getElementById('messageInput');
         this.sendButton = document.getElementById('sendButton');
@@ -23,7 +31,7 @@ class ChatRoom {
 
             this.ws.send(JSON.stringify({
                 type: 'join',
-                userId: 'User',
+                userId: userId,
                 roomId: 'room1',
                 // content: {
                 //     text: 'Lorem ipsum dolor sit amet, consectetur adipiscing elit. Sed do eiusmod tempor incididunt ut labore et dolore magna aliqua. Ut enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat. Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur. Excepteur sint occaecat cupidatat non proident, sunt in culpa qui officia deserunt mollit anim id est laborum.'
@@ -72,7 +80,7 @@ class ChatRoom {
         if (messageText) {
             const message = {
                 type: 'message',
-                userId: 'User', // This will be replaced with actual username later
+                userId: userId,
                 roomId: 'room1',
                 content: {
                     text: messageText,
@@ -106,12 +114,17 @@ class ChatRoom {
         const messageElement = document.createElement('div');
         messageElement.classList.add('message', type);
 
-        const messageContent = `
-            <span class="username">${message.userId}</span>
-            <span class="text">${message.content.text}</span>
-        `;
+        // Names and messages come from other users, they're set as
+        // text so they can't inject markup.
+        const usernameElement = document.createElement('span');
+        usernameElement.classList.add('username');
+        usernameElement.textContent = message.userId;
+
+        const textElement = document.createElement('span');
+        textElement.classList.add('text');
+        textElement.textContent = message.type === 'join' ? 'joined the room' : message.content.text;
 
-        messageElement.innerHTML = messageContent;
+        messageElement.append(usernameElement, ' ', textElement);
 
         container.appendChild(timestampElement);
         container.appendChild(messageElement);